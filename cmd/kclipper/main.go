@@ -10,11 +10,11 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
-	kclcmd "kcl-lang.io/cli/cmd/kcl/commands"
 	"kcl-lang.io/cli/pkg/plugin"
 
 	"github.com/MacroPower/kclipper/internal/cli"
 	"github.com/MacroPower/kclipper/pkg/log"
+	kclos "github.com/MacroPower/kclipper/pkg/os"
 	helmplugin "github.com/MacroPower/kclipper/pkg/plugin/helm"
 	httpplugin "github.com/MacroPower/kclipper/pkg/plugin/http"
 	osplugin "github.com/MacroPower/kclipper/pkg/plugin/os"
@@ -50,7 +50,7 @@ func main() {
 	if !envTrue("KCLX_HTTP_PLUGIN_DISABLED") {
 		httpplugin.Register()
 	}
-	if !envTrue("KCLX_OS_PLUGIN_DISABLED") {
+	if kclos.ExecEnabled() {
 		osplugin.Register()
 	}
 
@@ -68,7 +68,7 @@ func envTrue(key string) bool {
 
 // executeRunCmd the run command for the root command.
 func executeRunCmd(args []string) {
-	cmd := kclcmd.NewRunCmd()
+	cmd := cli.NewRunCmd()
 	cmd.SetArgs(args)
 	if err := cmd.Execute(); err != nil {
 		os.Exit(1)
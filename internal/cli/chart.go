@@ -3,6 +3,7 @@ package cli
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/spf13/cobra"
@@ -25,8 +26,17 @@ const (
   # Update chart schemas for the current module
   kcl chart update
 
+  # Pin OCI charts to the digest of their current tag
+  kcl chart update --pin_digest
+
   # Set chart configuration attributes
   kcl chart set --chart podinfo --overrides "targetRevision=6.7.1"
+
+  # Generate Markdown documentation for all charts
+  kcl chart docs --output docs/charts
+
+  # List charts and any compatibility warnings for a Kubernetes version
+  kcl chart list --kube_version 1.30.0
 `
 )
 
@@ -47,6 +57,8 @@ func NewChartCmd() *cobra.Command {
 	cmd.AddCommand(NewChartAddCmd())
 	cmd.AddCommand(NewChartUpdateCmd())
 	cmd.AddCommand(NewChartSetCmd())
+	cmd.AddCommand(NewChartDocsCmd())
+	cmd.AddCommand(NewChartListCmd())
 
 	return cmd
 }
@@ -112,13 +124,26 @@ func NewChartAddCmd() *cobra.Command {
 			if err != nil {
 				merr = multierror.Append(merr, err)
 			}
+			keyring, err := flags.GetString("keyring")
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+			opts, err := getChartPkgOpts(cc)
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+			pinDigest, err := flags.GetBool("pin_digest")
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
 
 			if merr != nil {
 				return fmt.Errorf("%w: %w", ErrInvalidArgument, merr)
 			}
 
-			c := helmutil.NewChartPkg(basePath, helm.DefaultClient)
-			return c.Add(chart, repoURL, targetRevision, schemaPath, schemaGenerator, schemaValidator)
+			opts = append(opts, helmutil.WithPinDigest(pinDigest))
+			c := helmutil.NewChartPkg(basePath, helm.DefaultClient, opts...)
+			return c.Add(chart, repoURL, targetRevision, schemaPath, keyring, schemaGenerator, schemaValidator)
 		},
 		SilenceUsage: true,
 	}
@@ -128,12 +153,15 @@ func NewChartAddCmd() *cobra.Command {
 	cmd.Flags().StringP("schema_generator", "G", "AUTO", "Chart schema generator")
 	cmd.Flags().StringP("schema_validator", "V", "KCL", "Chart schema validator")
 	cmd.Flags().StringP("schema_path", "P", "", "Chart schema path")
+	cmd.Flags().String("keyring", "", "Keyring used to verify the chart's provenance, relative to the module root")
+	cmd.Flags().Bool("pin_digest", false, "Pin the target revision of OCI charts to a digest")
+	addCompatibilityFlags(cmd)
 
 	return cmd
 }
 
 func NewChartUpdateCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "update",
 		Short: "Update charts",
 		RunE: func(cc *cobra.Command, _ []string) error {
@@ -142,11 +170,24 @@ func NewChartUpdateCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
 			}
-			c := helmutil.NewChartPkg(basePath, helm.DefaultClient)
+			opts, err := getChartPkgOpts(cc)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+			}
+			pinDigest, err := flags.GetBool("pin_digest")
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+			}
+			opts = append(opts, helmutil.WithPinDigest(pinDigest))
+			c := helmutil.NewChartPkg(basePath, helm.DefaultClient, opts...)
 			return c.Update()
 		},
 		SilenceUsage: true,
 	}
+	cmd.Flags().Bool("pin_digest", false, "Pin the target revision of OCI charts to a digest")
+	addCompatibilityFlags(cmd)
+
+	return cmd
 }
 
 func NewChartSetCmd() *cobra.Command {
@@ -190,3 +231,92 @@ func NewChartSetCmd() *cobra.Command {
 
 	return cmd
 }
+
+func NewChartDocsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate chart documentation",
+		RunE: func(cc *cobra.Command, _ []string) error {
+			var merr error
+
+			flags := cc.Flags()
+			basePath, err := flags.GetString("path")
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+			output, err := flags.GetString("output")
+			if err != nil {
+				merr = multierror.Append(merr, err)
+			}
+
+			if merr != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidArgument, merr)
+			}
+
+			c := helmutil.NewChartPkg(basePath, helm.DefaultClient)
+			return c.Docs(output)
+		},
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringP("output", "o", "docs", "Output directory for the generated Markdown files")
+	_ = cmd.MarkFlagDirname("output")
+
+	return cmd
+}
+
+func NewChartListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List charts and compatibility warnings",
+		RunE: func(cc *cobra.Command, _ []string) error {
+			flags := cc.Flags()
+			basePath, err := flags.GetString("path")
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+			}
+			opts, err := getChartPkgOpts(cc)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+			}
+			c := helmutil.NewChartPkg(basePath, helm.DefaultClient, opts...)
+			return c.List(cc.OutOrStdout())
+		},
+		SilenceUsage: true,
+	}
+	addCompatibilityFlags(cmd)
+
+	return cmd
+}
+
+// addCompatibilityFlags adds the flags used to check chart compatibility to
+// the given chart command. See [getChartPkgOpts].
+func addCompatibilityFlags(cmd *cobra.Command) {
+	cmd.Flags().String("kube_version", os.Getenv("KUBE_VERSION"),
+		"Kubernetes version to check chart compatibility against")
+	cmd.Flags().Bool("strict", false, "Fail on chart compatibility issues, rather than warning")
+}
+
+// getChartPkgOpts returns [helmutil.ChartPkgOpts] for the flags added by
+// [addCompatibilityFlags].
+func getChartPkgOpts(cc *cobra.Command) ([]helmutil.ChartPkgOpts, error) {
+	var merr error
+
+	flags := cc.Flags()
+	kubeVersion, err := flags.GetString("kube_version")
+	if err != nil {
+		merr = multierror.Append(merr, err)
+	}
+	strict, err := flags.GetBool("strict")
+	if err != nil {
+		merr = multierror.Append(merr, err)
+	}
+
+	if merr != nil {
+		return nil, merr
+	}
+
+	return []helmutil.ChartPkgOpts{
+		helmutil.WithKubeVersion(kubeVersion),
+		helmutil.WithStrictCompatibility(strict),
+	}, nil
+}
@@ -14,7 +14,7 @@ func NewRootCmd(name, shortDesc, longDesc string) *cobra.Command {
 		SilenceErrors: true,
 		Version:       GetVersionString(),
 	}
-	cmd.AddCommand(kclcmd.NewRunCmd())
+	cmd.AddCommand(NewRunCmd())
 	cmd.AddCommand(kclcmd.NewLintCmd())
 	cmd.AddCommand(kclcmd.NewDocCmd())
 	cmd.AddCommand(kclcmd.NewFmtCmd())
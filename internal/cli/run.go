@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	kclcmd "kcl-lang.io/cli/cmd/kcl/commands"
+
+	"github.com/MacroPower/kclipper/pkg/capabilities"
+)
+
+// NewRunCmd returns the KCL run command, with additional flags for selecting
+// the cluster capability profile used by the helm plugin.
+func NewRunCmd() *cobra.Command {
+	cmd := kclcmd.NewRunCmd()
+	cmd.Flags().String("capabilities", "",
+		fmt.Sprintf("Cluster capability profile to render Helm charts with (or %s)", capabilities.ProfileEnvVar))
+	cmd.Flags().String("capabilities_file", "",
+		fmt.Sprintf("Path to the cluster capability profiles file (or %s)", capabilities.FileEnvVar))
+
+	preRunE := cmd.PreRunE
+	preRun := cmd.PreRun
+	cmd.PreRun = nil
+	cmd.PreRunE = func(cc *cobra.Command, args []string) error {
+		if err := setCapabilitiesEnv(cc); err != nil {
+			return err
+		}
+		if preRunE != nil {
+			return preRunE(cc, args)
+		}
+		if preRun != nil {
+			preRun(cc, args)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// setCapabilitiesEnv sets the capability environment variables read by the
+// helm plugin from any capability flags that were provided.
+func setCapabilitiesEnv(cc *cobra.Command) error {
+	flags := cc.Flags()
+	envs := map[string]string{
+		"capabilities":      capabilities.ProfileEnvVar,
+		"capabilities_file": capabilities.FileEnvVar,
+	}
+	for flag, env := range envs {
+		if !flags.Changed(flag) {
+			continue
+		}
+		v, err := flags.GetString(flag)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", flag, err)
+		}
+		if err := os.Setenv(env, v); err != nil {
+			return fmt.Errorf("failed to set %s: %w", env, err)
+		}
+	}
+	return nil
+}
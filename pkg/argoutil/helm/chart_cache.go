@@ -0,0 +1,210 @@
+package helm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mitchellh/copystructure"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// DefaultChartCacheSize is the default maximum number of charts held by a
+// [ChartCache].
+const DefaultChartCacheSize = 64
+
+// ChartCache is an in-memory cache of loaded charts, keyed by the digest of
+// the chart archive or directory (see [ChartDigest]). It allows a chart that
+// is rendered many times by the same process to only be loaded once. At most
+// size charts are held, and the least recently used chart is evicted when a
+// new chart is loaded into a full cache.
+//
+// Parsed templates are not cached. Helm's engine parses every template into a
+// new template set on each render, binding functions such as `include`,
+// `tpl` and `lookup` to that render, and the install action does not accept
+// a pre-parsed set.
+type ChartCache struct {
+	charts map[string]*list.Element
+	lru    *list.List
+	size   int
+	mu     sync.Mutex
+}
+
+// chartCacheEntry is the value of each element in [ChartCache.lru].
+type chartCacheEntry struct {
+	chart  *chart.Chart
+	digest string
+}
+
+// NewChartCache returns a [ChartCache] holding at most size charts. If size is
+// not positive, [DefaultChartCacheSize] is used.
+func NewChartCache(size int) *ChartCache {
+	if size <= 0 {
+		size = DefaultChartCacheSize
+	}
+	return &ChartCache{
+		charts: map[string]*list.Element{},
+		lru:    list.New(),
+		size:   size,
+	}
+}
+
+// Load loads the chart at the given path, like [loader.Load]. If a chart with
+// the same digest was previously loaded, a copy of it is returned instead.
+// Each call returns a separate copy, since rendering a chart modifies it.
+func (cc *ChartCache) Load(path string) (*chart.Chart, error) {
+	digest, err := ChartDigest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, ok := cc.get(digest)
+	if !ok {
+		ch, err = loader.Load(path)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+		cc.add(digest, ch)
+	}
+
+	return copyChart(ch)
+}
+
+// Len returns the number of charts in the cache.
+func (cc *ChartCache) Len() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	return cc.lru.Len()
+}
+
+// get returns the cached chart with the given digest, and marks it as the
+// most recently used.
+func (cc *ChartCache) get(digest string) (*chart.Chart, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	e, ok := cc.charts[digest]
+	if !ok {
+		return nil, false
+	}
+	cc.lru.MoveToFront(e)
+	entry, _ := e.Value.(*chartCacheEntry)
+	return entry.chart, true
+}
+
+// add caches the chart with the given digest, evicting the least recently
+// used charts if the cache is full.
+func (cc *ChartCache) add(digest string, ch *chart.Chart) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if e, ok := cc.charts[digest]; ok {
+		// Loaded concurrently by another caller.
+		cc.lru.MoveToFront(e)
+		return
+	}
+	cc.charts[digest] = cc.lru.PushFront(&chartCacheEntry{chart: ch, digest: digest})
+	for cc.lru.Len() > cc.size {
+		entry, _ := cc.lru.Remove(cc.lru.Back()).(*chartCacheEntry)
+		delete(cc.charts, entry.digest)
+	}
+}
+
+// copyChart returns a copy of the given chart and its dependencies, which can
+// be rendered without modifying the original. Template and file contents are
+// shared, since they are never modified.
+func copyChart(ch *chart.Chart) (*chart.Chart, error) {
+	cp := *ch
+
+	if ch.Metadata != nil {
+		md := *ch.Metadata
+		md.Dependencies = make([]*chart.Dependency, 0, len(ch.Metadata.Dependencies))
+		for _, d := range ch.Metadata.Dependencies {
+			dep := *d
+			md.Dependencies = append(md.Dependencies, &dep)
+		}
+		cp.Metadata = &md
+	}
+
+	values, err := copystructure.Copy(ch.Values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy chart values: %w", err)
+	}
+	cp.Values, _ = values.(map[string]any)
+
+	deps := make([]*chart.Chart, 0, len(ch.Dependencies()))
+	for _, d := range ch.Dependencies() {
+		dep, err := copyChart(d)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, dep)
+	}
+	cp.SetDependencies(deps...)
+
+	return &cp, nil
+}
+
+// ChartDigest returns the SHA-256 digest of a chart archive, or of the paths
+// and contents of all files in a chart directory.
+func ChartDigest(path string) (string, error) {
+	h := sha256.New()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to digest chart: %w", err)
+	}
+	if !info.IsDir() {
+		if err := digestFile(h, path); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	// WalkDir walks files in lexical order, so the digest is deterministic.
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", p, err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", filepath.ToSlash(rel), fi.Size())
+		return digestFile(h, p)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to digest chart: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func digestFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
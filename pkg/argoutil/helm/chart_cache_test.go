@@ -0,0 +1,105 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChartCache(t *testing.T) {
+	t.Parallel()
+
+	cc := NewChartCache(DefaultChartCacheSize)
+
+	a, err := cc.Load("./testdata/redis")
+	require.NoError(t, err)
+	b, err := cc.Load("./testdata/redis")
+	require.NoError(t, err)
+	require.NotSame(t, a, b)
+	require.Equal(t, a.Metadata, b.Metadata)
+	require.Equal(t, a.Values, b.Values)
+
+	// Modifying a loaded chart does not modify the cached chart.
+	a.Metadata.KubeVersion = "modified"
+	a.Values["modified"] = true
+	c, err := cc.Load("./testdata/redis")
+	require.NoError(t, err)
+	require.NotEqual(t, "modified", c.Metadata.KubeVersion)
+	require.NotContains(t, c.Values, "modified")
+
+	_, err = cc.Load("./testdata/does-not-exist")
+	require.Error(t, err)
+}
+
+func TestChartCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	cc := NewChartCache(2)
+
+	redis, err := cc.Load("./testdata/redis")
+	require.NoError(t, err)
+	_, err = cc.Load("./testdata/minio")
+	require.NoError(t, err)
+	require.Equal(t, 2, cc.Len())
+
+	// Loading redis again marks it as the most recently used chart, so minio
+	// is evicted when the cache is full.
+	_, err = cc.Load("./testdata/redis")
+	require.NoError(t, err)
+	_, err = cc.Load("./testdata/hooks")
+	require.NoError(t, err)
+	require.Equal(t, 2, cc.Len())
+
+	redisDigest, err := ChartDigest("./testdata/redis")
+	require.NoError(t, err)
+	minioDigest, err := ChartDigest("./testdata/minio")
+	require.NoError(t, err)
+
+	ch, ok := cc.get(redisDigest)
+	require.True(t, ok)
+	require.Equal(t, redis.Metadata.Name, ch.Metadata.Name)
+	_, ok = cc.get(minioDigest)
+	require.False(t, ok)
+}
+
+func TestChartCacheTemplate(t *testing.T) {
+	t.Parallel()
+
+	opts := &TemplateOpts{
+		Name:      "test",
+		Namespace: "test",
+		Values:    map[string]any{"password": "test"},
+	}
+
+	h, err := NewHelmApp("./testdata/redis", false, "", "", "")
+	require.NoError(t, err)
+	want, _, err := h.Template(opts)
+	require.NoError(t, err)
+
+	cc := NewChartCache(DefaultChartCacheSize)
+	for range 3 {
+		h, err := NewHelmApp("./testdata/redis", false, "", "", "", WithChartCache(cc))
+		require.NoError(t, err)
+		got, _, err := h.Template(opts)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+}
+
+func TestChartDigest(t *testing.T) {
+	t.Parallel()
+
+	a, err := ChartDigest("./testdata/redis")
+	require.NoError(t, err)
+	b, err := ChartDigest("./testdata/redis")
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+
+	c, err := ChartDigest("./testdata/minio")
+	require.NoError(t, err)
+	require.NotEqual(t, a, c)
+
+	d, err := ChartDigest("./testdata/redis/Chart.yaml")
+	require.NoError(t, err)
+	require.NotEqual(t, a, d)
+}
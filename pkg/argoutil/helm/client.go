@@ -3,8 +3,10 @@ package helm
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,8 +22,6 @@ import (
 
 	"golang.org/x/net/http/httpproxy"
 	"gopkg.in/yaml.v3"
-	"oras.land/oras-go/v2/registry/remote"
-	"oras.land/oras-go/v2/registry/remote/auth"
 
 	"github.com/MacroPower/kclipper/pkg/argoutil/sync"
 	"github.com/MacroPower/kclipper/pkg/pathutil"
@@ -49,6 +49,7 @@ type Client interface {
 	ExtractChart(chart string, version string, project string, passCredentials bool, manifestMaxExtractedSize int64, disableManifestMaxExtractedSize bool) (string, io.Closer, error)
 	GetIndex(noCache bool, maxIndexSize int64) (*Index, error)
 	GetTags(chart string, noCache bool) (*TagsList, error)
+	ResolveDigest(chart string, version string) (string, error)
 	TestHelmOCI() (bool, error)
 }
 
@@ -60,6 +61,14 @@ func WithChartPaths(chartPaths pathutil.TempPaths) ClientOpts {
 	}
 }
 
+// WithKeyring makes the client verify the provenance of pulled charts using
+// the given keyring. Charts which fail verification are not cached.
+func WithKeyring(keyring string) ClientOpts {
+	return func(c *nativeHelmChart) {
+		c.keyring = keyring
+	}
+}
+
 func NewClient(repoURL string, creds Creds, enableOci bool, proxy string, noProxy string, opts ...ClientOpts) Client {
 	return NewClientWithLock(repoURL, creds, globalLock, enableOci, proxy, noProxy, opts...)
 }
@@ -90,6 +99,7 @@ type nativeHelmChart struct {
 	enableOci       bool
 	proxy           string
 	noProxy         string
+	keyring         string
 }
 
 func fileExist(filePath string) (bool, error) {
@@ -131,6 +141,13 @@ func (c *nativeHelmChart) PullChart(chart string, version string, project string
 		return "", fmt.Errorf("error creating Helm command: %w", err)
 	}
 	defer helmCmd.Close()
+	helmCmd.Keyring = c.keyring
+
+	if !c.enableOci {
+		if _, digest, err := ParseOCIVersion(version); err == nil && digest != "" {
+			return "", fmt.Errorf("%w: digests are only supported for OCI charts", ErrOCINotEnabled)
+		}
+	}
 
 	cachedChartPath, err := c.getCachedChartPath(chart, version, project)
 	if err != nil {
@@ -179,10 +196,17 @@ func (c *nativeHelmChart) PullChart(chart string, version string, project string
 		}
 
 		// 'helm pull/fetch' file downloads chart into the tgz file and we move that to where we want it
-		infos, err := os.ReadDir(tempDest)
+		entries, err := os.ReadDir(tempDest)
 		if err != nil {
 			return "", fmt.Errorf("error reading directory %s: %w", tempDest, err)
 		}
+		// Ignore any provenance file, which has already been verified.
+		infos := make([]os.DirEntry, 0, len(entries))
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), ".prov") {
+				infos = append(infos, e)
+			}
+		}
 		if len(infos) != 1 {
 			return "", fmt.Errorf("expected 1 file, found %v", len(infos))
 		}
@@ -193,6 +217,11 @@ func (c *nativeHelmChart) PullChart(chart string, version string, project string
 		if err != nil {
 			return "", fmt.Errorf("error renaming file from %s to %s: %w", chartFilePath, cachedChartPath, err)
 		}
+		if sealer, ok := c.chartCachePaths.(pathutil.Sealer); ok {
+			if err := sealer.Seal(cachedChartPath); err != nil {
+				return "", fmt.Errorf("error sealing cached chart path %s: %w", cachedChartPath, err)
+			}
+		}
 	}
 
 	return cachedChartPath, nil
@@ -221,6 +250,33 @@ func (c *nativeHelmChart) ExtractChart(chart string, version string, project str
 	}), nil
 }
 
+// ExtractChartArchive extracts the packaged chart at archivePath to a
+// temporary directory, and returns the path to the extracted chart. Calling
+// Close() on the returned [io.Closer] removes the extracted chart.
+func ExtractChartArchive(archivePath string, manifestMaxExtractedSize int64, disableManifestMaxExtractedSize bool) (string, io.Closer, error) {
+	tempDir, err := createTempDir(os.TempDir())
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	closer := newInlineCloser(func() error {
+		return os.RemoveAll(tempDir)
+	})
+
+	if err := untarChart(tempDir, archivePath, manifestMaxExtractedSize, disableManifestMaxExtractedSize); err != nil {
+		tryClose(closer)
+		return "", nil, fmt.Errorf("error untarring chart: %w", err)
+	}
+
+	// Chart archives contain a single directory, named after the chart.
+	entries, err := os.ReadDir(tempDir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		tryClose(closer)
+		return "", nil, fmt.Errorf("invalid chart archive %s: expected a single chart directory", archivePath)
+	}
+
+	return path.Join(tempDir, entries[0].Name()), closer, nil
+}
+
 func (c *nativeHelmChart) GetIndex(noCache bool, maxIndexSize int64) (*Index, error) {
 	indexLock.Lock(c.repoURL)
 	defer indexLock.Unlock(c.repoURL)
@@ -321,6 +377,52 @@ func (c *nativeHelmChart) loadRepoIndex(maxIndexSize int64) ([]byte, error) {
 	return data, nil
 }
 
+// DownloadFile downloads the file at the given HTTP(S) URL, using the given
+// credentials and proxy settings. An error is returned if the file is larger
+// than maxSize bytes.
+func DownloadFile(fileURL string, creds Creds, proxy, noProxy string, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating HTTP request: %w", err)
+	}
+	if creds.Username != "" || creds.Password != "" {
+		// only basic supported
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	tlsConf, err := newTLSConfig(creds)
+	if err != nil {
+		return nil, fmt.Errorf("error creating TLS config: %w", err)
+	}
+
+	tr := &http.Transport{
+		Proxy:             getCallback(proxy, noProxy),
+		TLSClientConfig:   tlsConf,
+		DisableKeepAlives: true,
+	}
+	client := http.Client{Transport: tr}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making HTTP request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %s: %s", fileURL, resp.Status)
+	}
+
+	// Read one extra byte, to detect files exceeding the maximum size.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file %s exceeds the maximum size of %d bytes", fileURL, maxSize)
+	}
+
+	return data, nil
+}
+
 func newTLSConfig(creds Creds) (*tls.Config, error) {
 	//nolint:gosec
 	tlsConfig := &tls.Config{InsecureSkipVerify: creds.InsecureSkipVerify}
@@ -362,7 +464,29 @@ func normalizeChartName(chart string) string {
 }
 
 func (c *nativeHelmChart) getCachedChartPath(chart string, version string, project string) (string, error) {
-	keyData, err := json.Marshal(map[string]string{"url": c.repoURL, "chart": chart, "version": version, "project": project})
+	key := map[string]string{"url": c.repoURL, "chart": chart, "version": version, "project": project}
+	if c.enableOci {
+		// Charts pinned to a digest are keyed by it, so they are never replaced
+		// by charts pulled after their tag was moved.
+		tag, digest, err := ParseOCIVersion(version)
+		if err != nil {
+			return "", err
+		}
+		if digest != "" {
+			key["version"] = digest
+			key["tag"] = tag
+		}
+	}
+	if c.keyring != "" {
+		// Verified charts must not be shared with unverified pulls, or pulls
+		// verified using a different keyring.
+		digest, err := KeyringDigest(c.keyring)
+		if err != nil {
+			return "", err
+		}
+		key["keyring"] = digest
+	}
+	keyData, err := json.Marshal(key)
 	if err != nil {
 		return "", fmt.Errorf("error marshaling cache key data: %w", err)
 	}
@@ -408,28 +532,9 @@ func (c *nativeHelmChart) GetTags(chart string, noCache bool) (*TagsList, error)
 	tags := &TagsList{}
 	if len(data) == 0 {
 		start := time.Now()
-		repo, err := remote.NewRepository(tagsURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize repository: %w", err)
-		}
-		tlsConf, err := newTLSConfig(c.creds)
+		repo, err := c.newOCIRepository(chart)
 		if err != nil {
-			return nil, fmt.Errorf("failed setup tlsConfig: %w", err)
-		}
-		client := &http.Client{Transport: &http.Transport{
-			Proxy:             getCallback(c.proxy, c.noProxy),
-			TLSClientConfig:   tlsConf,
-			DisableKeepAlives: true,
-		}}
-
-		repoHost, _, _ := strings.Cut(tagsURL, "/")
-		repo.Client = &auth.Client{
-			Client: client,
-			Cache:  nil,
-			Credential: auth.StaticCredential(repoHost, auth.Credential{
-				Username: c.creds.Username,
-				Password: c.creds.Password,
-			}),
+			return nil, err
 		}
 
 		ctx := context.Background()
@@ -474,3 +579,15 @@ func getCallback(proxy string, noProxy string) func(*http.Request) (*url.URL, er
 	// read proxy from env variable if custom proxy is missing
 	return http.ProxyFromEnvironment
 }
+
+// KeyringDigest returns a short digest of the contents of the given keyring,
+// which can be used to distinguish the cache keys of charts verified using
+// different keyrings.
+func KeyringDigest(keyring string) (string, error) {
+	data, err := os.ReadFile(keyring)
+	if err != nil {
+		return "", fmt.Errorf("error reading keyring: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
@@ -6,14 +6,17 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/postrender"
 	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/repo"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
@@ -28,6 +31,12 @@ type Cmd struct {
 	proxy     string
 	noProxy   string
 
+	// ChartCache is used to load charts, if set.
+	ChartCache *ChartCache
+	// Keyring is used to verify the provenance of fetched charts, if set
+	// (--verify --keyring).
+	Keyring string
+
 	cr       []*repo.ChartRepository
 	rc       *registry.Client
 	settings *cli.EnvSettings
@@ -214,6 +223,10 @@ func (c *Cmd) Fetch(repo, chartName, version, destination string, creds Creds, p
 	if passCredentials {
 		ap.PassCredentialsAll = true
 	}
+	if c.Keyring != "" {
+		ap.Verify = true
+		ap.Keyring = c.Keyring
+	}
 
 	out, err := ap.Run(chartName)
 	if err != nil {
@@ -222,7 +235,22 @@ func (c *Cmd) Fetch(repo, chartName, version, destination string, creds Creds, p
 	return out, nil
 }
 
+// PullOCI pulls an OCI chart into the destination directory. The version may
+// include a digest (see [ParseOCIVersion]), in which case the chart is pulled
+// by digest, and any tag must match the pulled chart's version.
 func (c *Cmd) PullOCI(repo string, chart string, version string, destination string, creds Creds) (string, error) {
+	tag, digest, err := ParseOCIVersion(version)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse OCI chart version: %w", err)
+	}
+	if digest != "" {
+		out, err := c.pullOCIDigest(repo, chart, tag, digest, destination)
+		if err != nil {
+			return "", fmt.Errorf("failed to pull OCI chart: %w", err)
+		}
+		return out, nil
+	}
+
 	repoURL := fmt.Sprintf("oci://%s/%s", repo, chart)
 	out, err := c.Fetch(repoURL, chart, version, destination, creds, false)
 	if err != nil {
@@ -231,19 +259,53 @@ func (c *Cmd) PullOCI(repo string, chart string, version string, destination str
 	return out, nil
 }
 
-func (c *Cmd) dependencyBuild() (string, error) {
-	// out, _, err := c.run("dependency", "build")
-	// if err != nil {
-	// 	return "", fmt.Errorf("failed to build dependencies: %w", err)
-	// }
-	return "ok", nil
+// pullOCIDigest pulls the OCI chart with the given manifest digest. Helm's
+// pull action only supports tags, so the registry client is used directly.
+func (c *Cmd) pullOCIDigest(repo, chart, tag, digest, destination string) (string, error) {
+	ref := fmt.Sprintf("%s/%s@%s", repo, chart, digest)
+	result, err := c.rc.Pull(ref, registry.PullOptWithProv(c.Keyring != ""))
+	if err != nil {
+		return "", fmt.Errorf("failed to pull %s: %w", ref, err)
+	}
+	if result.Manifest.Digest != digest {
+		return "", fmt.Errorf("pulled manifest digest %s does not match %s", result.Manifest.Digest, digest)
+	}
+
+	meta := result.Chart.Meta
+	// By convention: Change underscore (_) back to plus (+) to get valid SemVer
+	if tag != "" && strings.ReplaceAll(tag, "_", "+") != meta.Version {
+		return "", fmt.Errorf("chart version %s at digest %s does not match tag %s", meta.Version, digest, tag)
+	}
+
+	archivePath := filepath.Join(destination, fmt.Sprintf("%s-%s.tgz", meta.Name, meta.Version))
+	if err := os.WriteFile(archivePath, result.Chart.Data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write chart archive: %w", err)
+	}
+	if c.Keyring != "" {
+		if err := os.WriteFile(archivePath+".prov", result.Prov.Data, 0o600); err != nil {
+			return "", fmt.Errorf("failed to write chart provenance file: %w", err)
+		}
+		if _, err := downloader.VerifyChart(archivePath, c.Keyring); err != nil {
+			return "", fmt.Errorf("failed to verify chart: %w", err)
+		}
+	}
+
+	return fmt.Sprintf("Pulled: %s\nDigest: %s\n", ref, result.Manifest.Digest), nil
 }
 
 func (c *Cmd) template(chartPath string, opts *TemplateOpts) (string, string, error) {
+	rel, err := c.release(chartPath, opts)
+	if err != nil {
+		return "", "", err
+	}
+	return rel.Manifest, rel.Name, nil
+}
+
+func (c *Cmd) release(chartPath string, opts *TemplateOpts) (*Release, error) {
 	// if callback, err := cleanupChartLockFile(filepath.Clean(path.Join(c.WorkDir, chartPath))); err == nil {
 	// 	defer callback()
 	// } else {
-	// 	return "", "", fmt.Errorf("failed to clean up chart lock file: %w", err)
+	// 	return nil, fmt.Errorf("failed to clean up chart lock file: %w", err)
 	// }
 
 	// Fail open instead of blocking the template.
@@ -256,7 +318,7 @@ func (c *Cmd) template(chartPath string, opts *TemplateOpts) (string, string, er
 	if opts.KubeVersion != "" {
 		kv, err = chartutil.ParseKubeVersion(opts.KubeVersion)
 		if err != nil {
-			return "", "", fmt.Errorf("failed to parse kube version: %w", err)
+			return nil, fmt.Errorf("failed to parse kube version: %w", err)
 		}
 	}
 	av := chartutil.DefaultVersionSet
@@ -264,10 +326,21 @@ func (c *Cmd) template(chartPath string, opts *TemplateOpts) (string, string, er
 		av = opts.APIVersions
 	}
 
-	chart, err := loader.Load(filepath.Clean(path.Join(c.WorkDir, chartPath)))
+	load := loader.Load
+	if c.ChartCache != nil {
+		load = c.ChartCache.Load
+	}
+	chart, err := load(filepath.Clean(path.Join(c.WorkDir, chartPath)))
 	if err != nil {
-		return "", "", fmt.Errorf("failed to load chart: %w", err)
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+	// Helm's install action does not check for missing dependencies, so they
+	// would otherwise be silently ignored. Check them here so that they can be
+	// built by the caller (see [IsMissingDependencyErr]).
+	if err := action.CheckDependencies(chart, chart.Metadata.Dependencies); err != nil {
+		return nil, fmt.Errorf("failed to check chart dependencies: %w", err)
 	}
+
 	// Keeping the schema in the charts will cause downstream templating to load
 	// remote refs and validate against the schema, for the chart and all its
 	// dependencies. This can be a massive and random-feeling performance hit,
@@ -277,7 +350,18 @@ func (c *Cmd) template(chartPath string, opts *TemplateOpts) (string, string, er
 		removeSchemasFromObject(chart)
 	}
 
-	ta := action.NewInstall(&action.Configuration{
+	// Helm never checks deprecation, and only checks kubeVersion constraints
+	// against the fail-open version when none is set. Check both here, so that
+	// they can be surfaced as warnings unless strict compatibility is required.
+	if err := CheckCompatibility(chart.Metadata, opts.KubeVersion); err != nil {
+		if opts.StrictCompatibility {
+			return nil, fmt.Errorf("failed chart compatibility check: %w", err)
+		}
+		slog.Warn("chart compatibility check failed", "chart", chart.Name(), "err", err)
+	}
+	chart.Metadata.KubeVersion = ""
+
+	cfg := &action.Configuration{
 		KubeClient:     kube.New(genericclioptions.NewConfigFlags(false)),
 		RegistryClient: c.rc,
 		Capabilities: &chartutil.Capabilities{
@@ -285,11 +369,24 @@ func (c *Cmd) template(chartPath string, opts *TemplateOpts) (string, string, er
 			APIVersions: av,
 			HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
 		},
-	})
+	}
+	ta := action.NewInstall(cfg)
 	ta.DryRun = true
 	ta.DryRunOption = "client"
+	if opts.LookupObjects != nil {
+		// Helm only enables the `lookup` function for server-side dry runs. The
+		// install is still client-only, so the client getter is only used by
+		// `lookup`, which is served the given objects.
+		getter, err := newLookupClientGetter(opts.LookupObjects)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load lookup objects: %w", err)
+		}
+		cfg.RESTClientGetter = getter
+		ta.DryRunOption = "server"
+	}
 	ta.ClientOnly = true
 	ta.DisableOpenAPIValidation = true
+	ta.PostRenderer = opts.PostRenderer
 	ta.ReleaseName = opts.Name
 	ta.Namespace = opts.Namespace
 	ta.NameTemplate = opts.Name
@@ -304,12 +401,41 @@ func (c *Cmd) template(chartPath string, opts *TemplateOpts) (string, string, er
 		opts.Values = make(map[string]any)
 	}
 
-	release, err := ta.Run(chart, opts.Values)
+	rel, err := ta.Run(chart, opts.Values)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to run install action: %w", err)
+		manifest := ""
+		if rel != nil {
+			manifest = rel.Manifest
+		}
+		if tplErr := newTemplateError(err, chart, manifest, opts.ShowTemplateOnError); tplErr != nil {
+			return nil, tplErr
+		}
+		return nil, fmt.Errorf("failed to run install action: %w", err)
+	}
+
+	manifests, err := getManifests(rel, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	return release.Manifest, release.Name, nil
+	// Equivalent to `helm get values --all`.
+	values, err := chartutil.CoalesceValues(rel.Chart, rel.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to coalesce values: %w", err)
+	}
+
+	notes := ""
+	if rel.Info != nil {
+		notes = rel.Info.Notes
+	}
+
+	return &Release{
+		Name:     rel.Name,
+		Manifest: manifests,
+		Notes:    notes,
+		Chart:    rel.Chart,
+		Values:   values,
+	}, nil
 }
 
 func (c *Cmd) Close() {
@@ -352,6 +478,23 @@ type TemplateOpts struct {
 	SkipCrds    bool
 
 	SkipSchemaValidation bool
+	StrictCompatibility  bool
+
+	// IncludeHooks includes hook resources in the output.
+	IncludeHooks bool
+	// SkipTests excludes test hooks from the output, if hooks are included.
+	SkipTests bool
+	// ShowOnly restricts the output to manifests rendered from templates
+	// matching any of the given paths (e.g. "templates/deployment.yaml").
+	ShowOnly []string
+	// LookupObjects are returned by the `lookup` template function, as if they
+	// existed in the cluster. If nil, `lookup` always returns an empty result.
+	LookupObjects []map[string]any
+	// ShowTemplateOnError adds the offending template to any [TemplateError].
+	ShowTemplateOnError bool
+	// PostRenderer modifies the rendered manifests, like Helm's
+	// `--post-renderer`. Hooks and notes are not post-rendered.
+	PostRenderer postrender.PostRenderer
 }
 
 // // Workaround for Helm3 behavior (see https://github.com/helm/helm/issues/6870).
@@ -0,0 +1,41 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+var (
+	ErrChartDeprecated         = errors.New("chart is deprecated")
+	ErrIncompatibleKubeVersion = errors.New("chart is incompatible with the kubernetes version")
+)
+
+// CheckCompatibility inspects the chart metadata and returns an error for each
+// compatibility issue found, joined with [errors.Join]. The kube version
+// constraint is only checked when kubeVersion is not empty. Returns nil if no
+// issues were found.
+func CheckCompatibility(md *chart.Metadata, kubeVersion string) error {
+	if md == nil {
+		return nil
+	}
+
+	var errs []error
+	if md.Deprecated {
+		errs = append(errs, fmt.Errorf("%w: %s %s", ErrChartDeprecated, md.Name, md.Version))
+	}
+	if md.KubeVersion != "" && kubeVersion != "" {
+		kv, err := chartutil.ParseKubeVersion(kubeVersion)
+		if err != nil {
+			return fmt.Errorf("failed to parse kube version: %w", err)
+		}
+		if !chartutil.IsCompatibleRange(md.KubeVersion, kv.String()) {
+			errs = append(errs, fmt.Errorf("%w: %s %s requires kubeVersion %s, got %s",
+				ErrIncompatibleKubeVersion, md.Name, md.Version, md.KubeVersion, kv.String()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chartutil"
 )
 
@@ -23,27 +24,56 @@ type HelmRepository struct {
 type Helm interface {
 	// Template returns a list of unstructured objects from a `helm template` command
 	Template(opts *TemplateOpts) (string, string, error)
-	// DependencyBuild runs `helm dependency build` to download a chart's dependencies
-	DependencyBuild() error
+	// Release returns the release rendered by a `helm template` command
+	Release(opts *TemplateOpts) (*Release, error)
 	// Dispose deletes temp resources
 	Dispose()
 }
 
+// Release describes a release rendered by [Helm.Release].
+type Release struct {
+	// Name is the release name.
+	Name string
+	// Manifest contains the rendered manifests, as returned by [Helm.Template].
+	Manifest string
+	// Notes contains the rendered NOTES.txt of the chart.
+	Notes string
+	// Chart is the chart used for the release, after disabled dependencies
+	// have been removed.
+	Chart *chart.Chart
+	// Values are the fully coalesced values used for the release.
+	Values map[string]any
+}
+
+type HelmAppOpts func(h *helm)
+
+// WithChartCache sets the [ChartCache] used to load charts.
+func WithChartCache(cc *ChartCache) HelmAppOpts {
+	return func(h *helm) {
+		h.cmd.ChartCache = cc
+	}
+}
+
 // NewHelmApp create a new wrapper to run commands on the `helm` command-line tool.
-func NewHelmApp(workDir string, repos []HelmRepository, isLocal bool, version string, proxy string, noProxy string, passCredentials bool) (Helm, error) {
+func NewHelmApp(
+	workDir string, isLocal bool, version string, proxy string, noProxy string, opts ...HelmAppOpts,
+) (Helm, error) {
 	cmd, err := NewCmd(workDir, version, proxy, noProxy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new helm command: %w", err)
 	}
 	cmd.IsLocal = isLocal
 
-	return &helm{repos: repos, cmd: *cmd, passCredentials: passCredentials}, nil
+	h := &helm{cmd: *cmd}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h, nil
 }
 
 type helm struct {
-	cmd             Cmd
-	repos           []HelmRepository
-	passCredentials bool
+	cmd Cmd
 }
 
 var _ Helm = &helm{}
@@ -62,40 +92,12 @@ func (h *helm) Template(templateOpts *TemplateOpts) (string, string, error) {
 	return out, command, nil
 }
 
-func (h *helm) DependencyBuild() error {
-	isHelmOci := h.cmd.IsHelmOci
-	defer func() {
-		h.cmd.IsHelmOci = isHelmOci
-	}()
-
-	for i := range h.repos {
-		repo := h.repos[i]
-		if repo.EnableOci {
-			h.cmd.IsHelmOci = true
-			if repo.Creds.Username != "" && repo.Creds.Password != "" {
-				_, err := h.cmd.RegistryLogin(repo.Repo, repo.Creds)
-
-				defer func() {
-					_, _ = h.cmd.RegistryLogout(repo.Repo, repo.Creds)
-				}()
-
-				if err != nil {
-					return fmt.Errorf("failed to login to registry %s: %w", repo.Repo, err)
-				}
-			}
-		} else {
-			_, err := h.cmd.RepoAdd(repo.Name, repo.Repo, repo.Creds, h.passCredentials)
-			if err != nil {
-				return fmt.Errorf("failed to add helm repository %s: %w", repo.Repo, err)
-			}
-		}
-	}
-	h.repos = nil
-	_, err := h.cmd.dependencyBuild()
+func (h *helm) Release(templateOpts *TemplateOpts) (*Release, error) {
+	rel, err := h.cmd.release(".", templateOpts)
 	if err != nil {
-		return fmt.Errorf("failed to build helm dependencies: %w", err)
+		return nil, fmt.Errorf("failed to execute helm template command: %w", err)
 	}
-	return nil
+	return rel, nil
 }
 
 func (h *helm) Dispose() {
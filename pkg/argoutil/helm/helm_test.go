@@ -1,6 +1,7 @@
 package helm
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -34,7 +36,7 @@ func TestHelmTemplateValues(t *testing.T) {
 	repoRoot := "./testdata/redis"
 	repoRootAbs, err := filepath.Abs(repoRoot)
 	require.NoError(t, err)
-	h, err := NewHelmApp(repoRootAbs, []HelmRepository{}, false, "", "", "", false)
+	h, err := NewHelmApp(repoRootAbs, false, "", "", "")
 	require.NoError(t, err)
 	valuesPath := filepath.Join(repoRootAbs, "values-production.yaml")
 
@@ -66,7 +68,7 @@ func TestHelmTemplateValues(t *testing.T) {
 func TestHelmTemplateReleaseNameOverwrite(t *testing.T) {
 	t.Parallel()
 
-	h, err := NewHelmApp("./testdata/redis", nil, false, "", "", "", false)
+	h, err := NewHelmApp("./testdata/redis", false, "", "", "")
 	require.NoError(t, err)
 
 	objs, err := template(h, &TemplateOpts{Name: "my-release"})
@@ -86,7 +88,7 @@ func TestHelmTemplateReleaseNameOverwrite(t *testing.T) {
 func TestHelmTemplateReleaseName(t *testing.T) {
 	t.Parallel()
 
-	h, err := NewHelmApp("./testdata/redis", nil, false, "", "", "", false)
+	h, err := NewHelmApp("./testdata/redis", false, "", "", "")
 	require.NoError(t, err)
 	objs, err := template(h, &TemplateOpts{Name: "test"})
 	require.NoError(t, err)
@@ -105,7 +107,7 @@ func TestHelmTemplateReleaseName(t *testing.T) {
 func TestAPIVersions(t *testing.T) {
 	t.Parallel()
 
-	h, err := NewHelmApp("./testdata/api-versions", nil, false, "", "", "", false)
+	h, err := NewHelmApp("./testdata/api-versions", false, "", "", "")
 	require.NoError(t, err)
 
 	objs, err := template(h, &TemplateOpts{Name: "test-api-versions"})
@@ -122,7 +124,7 @@ func TestAPIVersions(t *testing.T) {
 func TestSkipCrds(t *testing.T) {
 	t.Parallel()
 
-	h, err := NewHelmApp("./testdata/crds", nil, false, "", "", "", false)
+	h, err := NewHelmApp("./testdata/crds", false, "", "", "")
 	require.NoError(t, err)
 
 	objs, err := template(h, &TemplateOpts{Name: "test-skip-crds", SkipCrds: false})
@@ -137,3 +139,302 @@ func TestSkipCrds(t *testing.T) {
 	require.NoError(t, err)
 	require.Empty(t, objs)
 }
+
+func TestCompatibility(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewHelmApp("./testdata/deprecated", false, "", "", "")
+	require.NoError(t, err)
+
+	// Compatibility issues are only warnings by default.
+	objs, err := template(h, &TemplateOpts{Name: "test-compat"})
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+
+	objs, err = template(h, &TemplateOpts{Name: "test-compat", KubeVersion: "1.30.0"})
+	require.NoError(t, err)
+	require.Len(t, objs, 1)
+
+	_, err = template(h, &TemplateOpts{Name: "test-compat", StrictCompatibility: true})
+	require.ErrorIs(t, err, ErrChartDeprecated)
+	require.NotErrorIs(t, err, ErrIncompatibleKubeVersion)
+
+	_, err = template(h, &TemplateOpts{Name: "test-compat", KubeVersion: "1.30.0", StrictCompatibility: true})
+	require.ErrorIs(t, err, ErrChartDeprecated)
+	require.ErrorIs(t, err, ErrIncompatibleKubeVersion)
+
+	_, err = template(h, &TemplateOpts{Name: "test-compat", KubeVersion: "1.24.3", StrictCompatibility: true})
+	require.ErrorIs(t, err, ErrChartDeprecated)
+	require.NotErrorIs(t, err, ErrIncompatibleKubeVersion)
+}
+
+func TestHooks(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewHelmApp("./testdata/hooks", false, "", "", "")
+	require.NoError(t, err)
+
+	tcs := map[string]struct {
+		opts  TemplateOpts
+		kinds []string
+		err   error
+	}{
+		"default": {
+			kinds: []string{"ConfigMap"},
+		},
+		"include hooks": {
+			opts:  TemplateOpts{IncludeHooks: true},
+			kinds: []string{"ConfigMap", "Job", "Pod"},
+		},
+		"skip tests": {
+			opts:  TemplateOpts{IncludeHooks: true, SkipTests: true},
+			kinds: []string{"ConfigMap", "Job"},
+		},
+		"show only": {
+			opts:  TemplateOpts{ShowOnly: []string{"templates/configmap.yaml"}},
+			kinds: []string{"ConfigMap"},
+		},
+		"show only hooks": {
+			opts:  TemplateOpts{IncludeHooks: true, ShowOnly: []string{"templates/tests/*", "templates/job.yaml"}},
+			kinds: []string{"Pod", "Job"},
+		},
+		"show only excluded hook": {
+			opts: TemplateOpts{ShowOnly: []string{"templates/job.yaml"}},
+			err:  ErrTemplateNotFound,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tc.opts
+			opts.Name = "test-hooks"
+			objs, err := template(h, &opts)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			kinds := []string{}
+			for _, obj := range objs {
+				kinds = append(kinds, obj.GetKind())
+			}
+			assert.ElementsMatch(t, tc.kinds, kinds)
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	lookupObjects := []map[string]any{
+		{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]any{"name": "lookup-secret", "namespace": "test"},
+			"data":       map[string]any{"password": "ZXhpc3Rpbmc="},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": "b", "namespace": "test"},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": "a", "namespace": "test"},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": "c", "namespace": "other"},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]any{"name": "test", "labels": map[string]any{"team": "platform"}},
+		},
+	}
+
+	tcs := map[string]struct {
+		lookupObjects []map[string]any
+		password      string
+		configMaps    string
+		namespace     string
+	}{
+		"no lookup objects": {
+			password:   "Z2VuZXJhdGVk",
+			configMaps: "",
+			namespace:  "none",
+		},
+		"empty lookup objects": {
+			lookupObjects: []map[string]any{},
+			password:      "Z2VuZXJhdGVk",
+			configMaps:    "",
+			namespace:     "none",
+		},
+		"lookup objects": {
+			lookupObjects: lookupObjects,
+			password:      "ZXhpc3Rpbmc=",
+			configMaps:    "a,b,",
+			namespace:     "platform",
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h, err := NewHelmApp("./testdata/lookup", false, "", "", "")
+			require.NoError(t, err)
+			objs, err := template(h, &TemplateOpts{
+				Name:          "test",
+				Namespace:     "test",
+				LookupObjects: tc.lookupObjects,
+			})
+			require.NoError(t, err)
+			require.Len(t, objs, 2)
+
+			for _, obj := range objs {
+				switch obj.GetKind() {
+				case "Secret":
+					password, _, err := unstructured.NestedString(obj.Object, "data", "password")
+					require.NoError(t, err)
+					assert.Equal(t, tc.password, password)
+				case "ConfigMap":
+					data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+					require.NoError(t, err)
+					assert.Equal(t, tc.configMaps, data["configMaps"])
+					assert.Equal(t, tc.namespace, data["namespaceLabel"])
+					assert.Equal(t, "false", data["crdFound"])
+				}
+			}
+		})
+	}
+
+	_, err := newLookupTransport([]map[string]any{{"kind": "Secret"}})
+	require.Error(t, err)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	t.Parallel()
+
+	h, err := NewHelmApp("./testdata/template-errors", false, "", "", "")
+	require.NoError(t, err)
+
+	tcs := map[string]struct {
+		values       map[string]any
+		showTemplate bool
+		want         TemplateError
+		template     string
+	}{
+		"required": {
+			values: map[string]any{"required": true, "image": map[string]any{}},
+			want: TemplateError{
+				Kind:       TemplateErrorFail,
+				File:       "template-errors/templates/configmap.yaml",
+				Line:       7,
+				Column:     10,
+				Message:    "image.tag is required",
+				ValuesPath: "image.tag",
+			},
+		},
+		"fail": {
+			values: map[string]any{"fail": true},
+			want: TemplateError{
+				Kind:    TemplateErrorFail,
+				File:    "template-errors/templates/configmap.yaml",
+				Line:    10,
+				Column:  6,
+				Message: "fail is set",
+			},
+		},
+		"execution": {
+			values:       map[string]any{"exec": true},
+			showTemplate: true,
+			want: TemplateError{
+				Kind:       TemplateErrorExecution,
+				File:       "template-errors/templates/configmap.yaml",
+				Line:       13,
+				Column:     21,
+				Message:    "nil pointer evaluating interface {}.key",
+				ValuesPath: "missing.key",
+			},
+			template: ">   13 |   missing: {{ .Values.missing.key }}",
+		},
+		"include": {
+			values: map[string]any{"include": true},
+			want: TemplateError{
+				Kind:       TemplateErrorExecution,
+				File:       "template-errors/templates/_helpers.tpl",
+				Line:       2,
+				Column:     10,
+				Message:    "nil pointer evaluating interface {}.name",
+				ValuesPath: "nested.name",
+			},
+		},
+		"sub chart": {
+			values: map[string]any{"sub": map[string]any{"subExec": true}},
+			want: TemplateError{
+				Kind:       TemplateErrorExecution,
+				File:       "template-errors/charts/sub/templates/configmap.yaml",
+				Line:       7,
+				Column:     17,
+				Message:    "nil pointer evaluating interface {}.key",
+				ValuesPath: "missing.key",
+			},
+		},
+		"yaml": {
+			values:       map[string]any{"yaml": true},
+			showTemplate: true,
+			want: TemplateError{
+				Kind: TemplateErrorYAML,
+				File: "template-errors/templates/invalid.yaml",
+			},
+			template: "data: [",
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := h.Release(&TemplateOpts{
+				Name:                "test",
+				Values:              tc.values,
+				ShowTemplateOnError: tc.showTemplate,
+			})
+			require.Error(t, err)
+
+			tplErr, ok := AsTemplateError(err)
+			require.True(t, ok, err.Error())
+			assert.Equal(t, tc.want.Kind, tplErr.Kind)
+			assert.Equal(t, tc.want.File, tplErr.File)
+			assert.Equal(t, tc.want.Line, tplErr.Line)
+			assert.Equal(t, tc.want.Column, tplErr.Column)
+			if tc.want.Message != "" {
+				assert.Equal(t, tc.want.Message, tplErr.Message)
+			}
+			assert.Equal(t, tc.want.ValuesPath, tplErr.ValuesPath)
+			if tc.template != "" {
+				assert.Contains(t, tplErr.Template, tc.template)
+			} else {
+				assert.Empty(t, tplErr.Template)
+			}
+		})
+	}
+
+	// Parse errors can't be caused by values, since all templates are parsed.
+	parseErr := newTemplateError(
+		errors.New(`parse error at (test/templates/configmap.yaml:3): function "foo" not defined`),
+		&chart.Chart{Metadata: &chart.Metadata{Name: "test"}}, "", true)
+	require.NotNil(t, parseErr)
+	assert.Equal(t, TemplateErrorParse, parseErr.Kind)
+	assert.Equal(t, 3, parseErr.Line)
+	assert.Equal(t, `test/templates/configmap.yaml:3: parse error: function "foo" not defined`, parseErr.Error())
+
+	// Other errors are not template errors.
+	_, err = h.Release(&TemplateOpts{Name: "test", KubeVersion: "invalid"})
+	require.Error(t, err)
+	_, ok := AsTemplateError(err)
+	require.False(t, ok)
+}
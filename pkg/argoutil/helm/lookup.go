@@ -0,0 +1,231 @@
+package helm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// lookupHost is the host of the fake API server used by [lookupClientGetter].
+// Requests are never sent over the network.
+const lookupHost = "http://lookup.kclipper.invalid"
+
+var ErrLookupNotSupported = errors.New("not supported when rendering with lookup objects")
+
+// lookupClientGetter provides the Helm engine with a client for a fake API
+// server, which serves a fixed set of objects. This allows the `lookup`
+// template function to return deterministic results without a cluster.
+type lookupClientGetter struct {
+	rt *lookupTransport
+}
+
+func newLookupClientGetter(objs []map[string]any) (*lookupClientGetter, error) {
+	rt, err := newLookupTransport(objs)
+	if err != nil {
+		return nil, err
+	}
+	return &lookupClientGetter{rt: rt}, nil
+}
+
+func (g *lookupClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return &rest.Config{
+		Host:      lookupHost,
+		Transport: g.rt,
+	}, nil
+}
+
+func (g *lookupClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return nil, fmt.Errorf("discovery client %w", ErrLookupNotSupported)
+}
+
+func (g *lookupClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	return nil, fmt.Errorf("rest mapper %w", ErrLookupNotSupported)
+}
+
+// lookupResource contains the objects of a single API resource.
+type lookupResource struct {
+	kind       string
+	namespaced bool
+	objs       []*unstructured.Unstructured
+}
+
+// lookupTransport is an [http.RoundTripper] implementing the subset of the
+// Kubernetes API used by Helm's `lookup` function: resource discovery for a
+// group version, and getting or listing objects.
+type lookupTransport struct {
+	// resources maps each group version to its resources, by resource name.
+	resources map[schema.GroupVersion]map[string]*lookupResource
+}
+
+func newLookupTransport(objs []map[string]any) (*lookupTransport, error) {
+	rt := &lookupTransport{
+		resources: map[schema.GroupVersion]map[string]*lookupResource{},
+	}
+	for i, o := range objs {
+		obj := &unstructured.Unstructured{Object: o}
+		gvk := obj.GroupVersionKind()
+		if gvk.Version == "" || gvk.Kind == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("lookup object %d: apiVersion, kind and metadata.name are required", i)
+		}
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		gv := gvk.GroupVersion()
+		if rt.resources[gv] == nil {
+			rt.resources[gv] = map[string]*lookupResource{}
+		}
+		res, ok := rt.resources[gv][plural.Resource]
+		if !ok {
+			res = &lookupResource{kind: gvk.Kind}
+			rt.resources[gv][plural.Resource] = res
+		}
+		res.namespaced = res.namespaced || obj.GetNamespace() != ""
+		res.objs = append(res.objs, obj)
+	}
+	for _, resources := range rt.resources {
+		for _, res := range resources {
+			sort.Slice(res.objs, func(i, j int) bool {
+				a, b := res.objs[i], res.objs[j]
+				if a.GetNamespace() != b.GetNamespace() {
+					return a.GetNamespace() < b.GetNamespace()
+				}
+				return a.GetName() < b.GetName()
+			})
+		}
+	}
+	return rt, nil
+}
+
+func (rt *lookupTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	if req.Method != http.MethodGet {
+		return rt.status(req, http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed)
+	}
+
+	gv, segments, ok := parseLookupPath(req.URL.Path)
+	if !ok {
+		return rt.status(req, http.StatusNotFound, metav1.StatusReasonNotFound)
+	}
+	resources := rt.resources[gv]
+
+	// Resource discovery for the group version.
+	if len(segments) == 0 {
+		list := metav1.APIResourceList{
+			TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+			GroupVersion: gv.String(),
+		}
+		names := make([]string, 0, len(resources))
+		for name := range resources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       name,
+				Namespaced: resources[name].namespaced,
+				Kind:       resources[name].kind,
+				Verbs:      metav1.Verbs{"get", "list"},
+			})
+		}
+		return rt.json(req, http.StatusOK, list)
+	}
+
+	var namespace, resource, name string
+	switch {
+	case segments[0] == "namespaces" && len(segments) > 2:
+		namespace, resource = segments[1], segments[2]
+		if len(segments) > 3 {
+			name = segments[3]
+		}
+	default:
+		resource = segments[0]
+		if len(segments) > 1 {
+			name = segments[1]
+		}
+	}
+
+	res, ok := resources[resource]
+	if !ok {
+		return rt.status(req, http.StatusNotFound, metav1.StatusReasonNotFound)
+	}
+
+	items := []any{}
+	for _, obj := range res.objs {
+		if namespace != "" && obj.GetNamespace() != namespace {
+			continue
+		}
+		if name == "" {
+			items = append(items, obj.Object)
+			continue
+		}
+		if obj.GetName() == name {
+			return rt.json(req, http.StatusOK, obj.Object)
+		}
+	}
+	if name != "" {
+		return rt.status(req, http.StatusNotFound, metav1.StatusReasonNotFound)
+	}
+
+	return rt.json(req, http.StatusOK, map[string]any{
+		"apiVersion": gv.String(),
+		"kind":       res.kind + "List",
+		"metadata":   map[string]any{},
+		"items":      items,
+	})
+}
+
+// parseLookupPath parses an API path, returning the group version, and any
+// remaining path segments.
+func parseLookupPath(path string) (schema.GroupVersion, []string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		// The core group only has a single version. Helm requests paths like
+		// "/api/<name>" when a kind is not found by discovery, which must
+		// result in a NotFound error rather than a resource list.
+		if segments[1] != "v1" {
+			return schema.GroupVersion{}, nil, false
+		}
+		return schema.GroupVersion{Version: segments[1]}, segments[2:], true
+	case len(segments) >= 3 && segments[0] == "apis":
+		return schema.GroupVersion{Group: segments[1], Version: segments[2]}, segments[3:], true
+	}
+	return schema.GroupVersion{}, nil, false
+}
+
+func (rt *lookupTransport) status(req *http.Request, code int, reason metav1.StatusReason) (*http.Response, error) {
+	return rt.json(req, code, metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  fmt.Sprintf("%s %s", reason, req.URL.Path),
+		Reason:   reason,
+		Code:     int32(code), //nolint:gosec
+	})
+}
+
+func (rt *lookupTransport) json(req *http.Request, code int, v any) (*http.Response, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &http.Response{
+		StatusCode:    code,
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
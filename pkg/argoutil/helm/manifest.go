@@ -0,0 +1,80 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("could not find template in chart")
+
+	manifestNameRegexp = regexp.MustCompile("# Source: [^/]+/(.+)")
+)
+
+// getManifests returns the manifests rendered for the release, in the same way
+// as `helm template`. Hooks are only included if [TemplateOpts.IncludeHooks]
+// is set, and test hooks are excluded if [TemplateOpts.SkipTests] is set. If
+// [TemplateOpts.ShowOnly] is set, only manifests rendered from the matching
+// template paths are returned.
+func getManifests(rel *release.Release, opts *TemplateOpts) (string, error) {
+	var manifests strings.Builder
+	manifests.WriteString(rel.Manifest)
+	if opts.IncludeHooks {
+		for _, h := range rel.Hooks {
+			if opts.SkipTests && isTestHook(h) {
+				continue
+			}
+			fmt.Fprintf(&manifests, "\n---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+		}
+	}
+
+	if len(opts.ShowOnly) == 0 {
+		return manifests.String(), nil
+	}
+
+	splitManifests := releaseutil.SplitManifests(manifests.String())
+	manifestKeys := make([]string, 0, len(splitManifests))
+	for k := range splitManifests {
+		manifestKeys = append(manifestKeys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(manifestKeys))
+
+	manifestsToRender := []string{}
+	for _, f := range opts.ShowOnly {
+		missing := true
+		f = filepath.ToSlash(f)
+		for _, k := range manifestKeys {
+			manifest := splitManifests[k]
+			submatch := manifestNameRegexp.FindStringSubmatch(manifest)
+			if len(submatch) == 0 {
+				continue
+			}
+			if matched, _ := filepath.Match(f, submatch[1]); !matched {
+				continue
+			}
+			manifestsToRender = append(manifestsToRender, manifest)
+			missing = false
+		}
+		if missing {
+			return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, f)
+		}
+	}
+
+	return strings.Join(manifestsToRender, "\n---\n"), nil
+}
+
+func isTestHook(h *release.Hook) bool {
+	for _, e := range h.Events {
+		if e == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
@@ -128,6 +128,34 @@ func (_m *Client) GetTags(chart string, noCache bool) (*helm.TagsList, error) {
 	return r0, r1
 }
 
+// ResolveDigest provides a mock function with given fields: chart, version
+func (_m *Client) ResolveDigest(chart string, version string) (string, error) {
+	ret := _m.Called(chart, version)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ResolveDigest")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (string, error)); ok {
+		return rf(chart, version)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(chart, version)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(chart, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // TestHelmOCI provides a mock function with given fields:
 func (_m *Client) TestHelmOCI() (bool, error) {
 	ret := _m.Called()
@@ -0,0 +1,107 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+var ErrInvalidOCIDigest = errors.New("invalid OCI digest")
+
+// ParseOCIVersion splits an OCI chart version into its tag and digest. The
+// version may be a tag ("1.2.3"), a digest ("sha256:<hex>" or
+// "@sha256:<hex>"), or a tag pinned to a digest ("1.2.3@sha256:<hex>"). Tags
+// can never contain ':', so any version containing one is parsed as a digest.
+func ParseOCIVersion(version string) (string, string, error) {
+	tag, digest, found := strings.Cut(version, "@")
+	if !found {
+		if !strings.Contains(version, ":") {
+			return version, "", nil
+		}
+		tag, digest = "", version
+	}
+
+	ref := registry.Reference{Reference: digest}
+	if err := ref.ValidateReferenceAsDigest(); err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidOCIDigest, err)
+	}
+	return tag, digest, nil
+}
+
+// FormatOCIVersion returns the version of an OCI chart with the given tag
+// and/or digest, which can be parsed by [ParseOCIVersion].
+func FormatOCIVersion(tag, digest string) string {
+	if digest == "" {
+		return tag
+	}
+	if tag == "" {
+		return digest
+	}
+	return tag + "@" + digest
+}
+
+// ResolveDigest returns the digest of the manifest currently tagged with the
+// given version in the chart's OCI repository. Pulls using the returned
+// digest (see [ParseOCIVersion]) will always return the same chart, even if
+// the tag is later moved.
+func (c *nativeHelmChart) ResolveDigest(chart string, version string) (string, error) {
+	if !c.enableOci {
+		return "", ErrOCINotEnabled
+	}
+
+	tag, digest, err := ParseOCIVersion(version)
+	if err != nil {
+		return "", err
+	}
+	if digest != "" {
+		return digest, nil
+	}
+
+	repo, err := c.newOCIRepository(chart)
+	if err != nil {
+		return "", err
+	}
+
+	// By convention: Change plus (+) to underscore (_) to get a valid tag.
+	desc, err := repo.Resolve(context.Background(), strings.ReplaceAll(tag, "+", "_"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve tag %q: %w", tag, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+// newOCIRepository returns a client for the chart's OCI repository, using the
+// configured credentials and proxy.
+func (c *nativeHelmChart) newOCIRepository(chart string) (*remote.Repository, error) {
+	repoURL := strings.Replace(fmt.Sprintf("%s/%s", c.repoURL, chart), "https://", "", 1)
+	repo, err := remote.NewRepository(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize repository: %w", err)
+	}
+	tlsConf, err := newTLSConfig(c.creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed setup tlsConfig: %w", err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:             getCallback(c.proxy, c.noProxy),
+		TLSClientConfig:   tlsConf,
+		DisableKeepAlives: true,
+	}}
+
+	repoHost, _, _ := strings.Cut(repoURL, "/")
+	repo.Client = &auth.Client{
+		Client: client,
+		Cache:  nil,
+		Credential: auth.StaticCredential(repoHost, auth.Credential{
+			Username: c.creds.Username,
+			Password: c.creds.Password,
+		}),
+	}
+	return repo, nil
+}
@@ -0,0 +1,140 @@
+package helm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MacroPower/kclipper/pkg/pathutil"
+)
+
+const (
+	testDigest      = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+	testOtherDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000002"
+)
+
+func TestParseOCIVersion(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		version string
+		tag     string
+		digest  string
+		err     bool
+	}{
+		"Tag":          {version: "1.2.3", tag: "1.2.3"},
+		"Empty":        {version: ""},
+		"Digest":       {version: testDigest, digest: testDigest},
+		"AtDigest":     {version: "@" + testDigest, digest: testDigest},
+		"TagAndDigest": {version: "1.2.3@" + testDigest, tag: "1.2.3", digest: testDigest},
+		"Constraint":   {version: "~1.2.3", tag: "~1.2.3"},
+		"BadDigest":    {version: "1.2.3@sha256:abc", err: true},
+		"EmptyDigest":  {version: "1.2.3@", err: true},
+		"NoAlgorithm":  {version: "1.2.3@" + strings.TrimPrefix(testDigest, "sha256:"), err: true},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tag, digest, err := ParseOCIVersion(tc.version)
+			if tc.err {
+				require.ErrorIs(t, err, ErrInvalidOCIDigest)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.tag, tag)
+			assert.Equal(t, tc.digest, digest)
+			assert.Equal(t, strings.TrimPrefix(tc.version, "@"), FormatOCIVersion(tag, digest))
+		})
+	}
+}
+
+func TestPullChartDigest(t *testing.T) {
+	t.Parallel()
+
+	t.Run("should key the cache by digest", func(t *testing.T) {
+		t.Parallel()
+
+		paths := pathutil.NewRandomizedTempPaths(t.TempDir())
+		c := &nativeHelmChart{repoURL: "example.com/charts", enableOci: true, chartCachePaths: paths}
+
+		cachePaths := map[string]string{}
+		for _, version := range []string{"1.2.3", "1.2.3@" + testDigest, "1.2.3@" + testOtherDigest, testDigest} {
+			p, err := c.getCachedChartPath("mychart", version, "")
+			require.NoError(t, err)
+			assert.NotContains(t, cachePaths, p, "version %s", version)
+			cachePaths[p] = version
+		}
+
+		p, err := c.getCachedChartPath("mychart", "@"+testDigest, "")
+		require.NoError(t, err)
+		assert.Equal(t, testDigest, cachePaths[p])
+
+		_, err = c.getCachedChartPath("mychart", "1.2.3@sha256:abc", "")
+		require.ErrorIs(t, err, ErrInvalidOCIDigest)
+	})
+
+	t.Run("should use charts cached by digest", func(t *testing.T) {
+		t.Parallel()
+
+		paths := pathutil.NewRandomizedTempPaths(t.TempDir())
+		client := NewClient("example.invalid/charts", Creds{}, true, "", "", WithChartPaths(paths))
+
+		c, ok := client.(*nativeHelmChart)
+		require.True(t, ok)
+		cachedPath, err := c.getCachedChartPath("mychart", "1.2.3@"+testDigest, "")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(cachedPath, []byte("chart"), 0o600))
+
+		got, err := client.PullChart("mychart", "1.2.3@"+testDigest, "", false, 0, true)
+		require.NoError(t, err)
+		assert.Equal(t, cachedPath, got)
+	})
+
+	t.Run("should return an error when oci is not enabled", func(t *testing.T) {
+		t.Parallel()
+
+		client := NewClient("https://example.invalid/charts", Creds{}, false, "", "")
+
+		_, err := client.PullChart("mychart", "1.2.3@"+testDigest, "", false, 0, true)
+		require.ErrorIs(t, err, ErrOCINotEnabled)
+	})
+}
+
+func TestResolveDigest(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Logf("called %s %s", r.Method, r.URL.Path)
+		if r.URL.Path != "/v2/mychart/manifests/1.2.3_build" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", testDigest)
+		w.Header().Set("Content-Length", "2")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, Creds{InsecureSkipVerify: true}, true, "", "")
+
+	digest, err := client.ResolveDigest("mychart", "1.2.3+build")
+	require.NoError(t, err)
+	assert.Equal(t, testDigest, digest)
+
+	digest, err = client.ResolveDigest("mychart", "1.2.3@"+testOtherDigest)
+	require.NoError(t, err)
+	assert.Equal(t, testOtherDigest, digest)
+
+	_, err = client.ResolveDigest("mychart", "4.5.6")
+	require.Error(t, err)
+
+	_, err = NewClient("example.com", Creds{}, false, "", "").ResolveDigest("mychart", "1.2.3")
+	require.ErrorIs(t, err, ErrOCINotEnabled)
+}
@@ -0,0 +1,242 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// TemplateErrorKind is the kind of a [TemplateError].
+type TemplateErrorKind string
+
+const (
+	// TemplateErrorFail is an error returned by a chart's use of the `fail` or
+	// `required` template functions. The message is written by the chart's
+	// authors, and is usually actionable on its own.
+	TemplateErrorFail TemplateErrorKind = "fail"
+	// TemplateErrorExecution is an error returned by the template engine while
+	// executing a template, e.g. when calling a function with invalid values.
+	TemplateErrorExecution TemplateErrorKind = "execution"
+	// TemplateErrorParse is an error returned when parsing a template.
+	TemplateErrorParse TemplateErrorKind = "parse"
+	// TemplateErrorYAML is an error returned when a rendered template is not
+	// valid YAML.
+	TemplateErrorYAML TemplateErrorKind = "yaml"
+)
+
+var (
+	// Helm's cleaned up `fail` and `required` errors, and parse errors.
+	failErrorRegexp  = regexp.MustCompile(`(?s)^execution error at \((.+?)\): (.*)$`)
+	parseErrorRegexp = regexp.MustCompile(`(?s)^parse error (?:at|in) \((.+?)\): (.*)$`)
+	// Go template execution errors, which Helm returns unchanged.
+	execErrorRegexp = regexp.MustCompile(`(?s)^template: (.+?): executing "[^"]*" at <(.*?)>: (.*)$`)
+	// Helm's YAML errors, returned when sorting the rendered manifests.
+	yamlErrorRegexp = regexp.MustCompile(`(?s)^YAML parse error on (.+?): (.*)$`)
+
+	locationRegexp     = regexp.MustCompile(`^(.+?)(?::(\d+))?(?::(\d+))?$`)
+	valuesPathRegexp   = regexp.MustCompile(`^\.Values((?:\.[A-Za-z0-9_-]+)+)`)
+	requiredCallRegexp = regexp.MustCompile("^required\\s+(?:\"(?:[^\"\\\\]|\\\\.)*\"|`[^`]*`)\\s+\\.Values((?:\\.[A-Za-z0-9_-]+)+)")
+)
+
+// TemplateError is a structured error returned when rendering a chart fails,
+// identifying the template and, when known, the values which caused it.
+type TemplateError struct {
+	Kind TemplateErrorKind
+	// File is the path of the template, including the chart name and any
+	// parent charts, e.g. "my-chart/charts/sub-chart/templates/service.yaml".
+	File string
+	// Line and Column are the position of the error in the template, as
+	// reported by Helm, if known. Lines are one-based, and columns are
+	// zero-based byte offsets.
+	Line   int
+	Column int
+	// Message is the error message, without Helm's location prefixes.
+	Message string
+	// ValuesPath is the path of the values key which caused the error, if it
+	// is known, e.g. "image.tag". The path is relative to the values of the
+	// chart containing the template.
+	ValuesPath string
+	// Template is the offending template source (for fail, execution and parse
+	// errors) or rendered template (for YAML errors), if requested using
+	// [TemplateOpts.ShowTemplateOnError].
+	Template string
+
+	err error
+}
+
+func (e *TemplateError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&sb, ":%d", e.Column)
+		}
+	}
+	sb.WriteString(": ")
+	if e.Kind != TemplateErrorFail {
+		fmt.Fprintf(&sb, "%s error: ", e.Kind)
+	}
+	sb.WriteString(e.Message)
+	if e.ValuesPath != "" {
+		fmt.Fprintf(&sb, " (values: %s)", e.ValuesPath)
+	}
+	if e.Template != "" {
+		fmt.Fprintf(&sb, "\n\n%s", strings.TrimRight(e.Template, "\n"))
+	}
+	return sb.String()
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.err
+}
+
+// AsTemplateError returns the [TemplateError] in err's chain, if any.
+func AsTemplateError(err error) (*TemplateError, bool) {
+	var tplErr *TemplateError
+	if errors.As(err, &tplErr) {
+		return tplErr, true
+	}
+	return nil, false
+}
+
+// newTemplateError parses an error returned by Helm when rendering the given
+// chart. If err is not a template error, nil is returned. If showTemplate is
+// set, the offending template is added to the error. manifest is the rendered
+// output attached to the release, used for YAML errors.
+func newTemplateError(err error, ch *chart.Chart, manifest string, showTemplate bool) *TemplateError {
+	msg := err.Error()
+
+	var tplErr *TemplateError
+	var context string
+	if m := failErrorRegexp.FindStringSubmatch(msg); m != nil {
+		tplErr = &TemplateError{Kind: TemplateErrorFail, Message: m[2]}
+		tplErr.setLocation(m[1])
+	} else if m := parseErrorRegexp.FindStringSubmatch(msg); m != nil {
+		tplErr = &TemplateError{Kind: TemplateErrorParse, Message: m[2]}
+		tplErr.setLocation(m[1])
+	} else if m := innermostExecError(msg); m != nil {
+		tplErr = &TemplateError{Kind: TemplateErrorExecution, Message: m[3]}
+		tplErr.setLocation(m[1])
+		context = m[2]
+	} else if m := yamlErrorRegexp.FindStringSubmatch(msg); m != nil {
+		tplErr = &TemplateError{Kind: TemplateErrorYAML, File: m[1], Message: m[2]}
+	} else {
+		return nil
+	}
+	tplErr.err = err
+
+	if tplErr.Kind == TemplateErrorYAML {
+		if showTemplate {
+			tplErr.Template = renderedTemplate(manifest, tplErr.File)
+		}
+		return tplErr
+	}
+
+	source, ok := findTemplate(ch, tplErr.File)
+	if !ok {
+		return tplErr
+	}
+	lines := strings.Split(source, "\n")
+
+	// Values paths are known from the template engine's context for execution
+	// errors, or from the call to `required` for fail errors.
+	if m := valuesPathRegexp.FindStringSubmatch(context); m != nil {
+		tplErr.ValuesPath = strings.TrimPrefix(m[1], ".")
+	} else if tplErr.Kind == TemplateErrorFail && tplErr.Line > 0 && tplErr.Line <= len(lines) {
+		line := lines[tplErr.Line-1]
+		// Columns are zero-based byte offsets.
+		if col := tplErr.Column; col < len(line) {
+			if m := requiredCallRegexp.FindStringSubmatch(line[col:]); m != nil {
+				tplErr.ValuesPath = strings.TrimPrefix(m[1], ".")
+			}
+		}
+	}
+
+	if showTemplate {
+		tplErr.Template = templateSnippet(lines, tplErr.Line)
+	}
+
+	return tplErr
+}
+
+// innermostExecError returns the submatches of [execErrorRegexp] for the
+// innermost template execution error in msg. Errors in templates called using
+// `include` or `tpl` are nested in the error of the calling template.
+func innermostExecError(msg string) []string {
+	for i := strings.LastIndex(msg, "template: "); i >= 0; i = strings.LastIndex(msg[:i], "template: ") {
+		if m := execErrorRegexp.FindStringSubmatch(msg[i:]); m != nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// setLocation sets the file, line and column from a location in the format
+// "file:line:column", where line and column are optional.
+func (e *TemplateError) setLocation(location string) {
+	m := locationRegexp.FindStringSubmatch(location)
+	if m == nil {
+		e.File = location
+		return
+	}
+	e.File = m[1]
+	e.Line, _ = strconv.Atoi(m[2])
+	e.Column, _ = strconv.Atoi(m[3])
+}
+
+// findTemplate returns the source of the template with the given name, which
+// includes the chart name and any parent charts (see [chart.Chart.ChartFullPath]).
+func findTemplate(ch *chart.Chart, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(name, ch.Name()+"/")
+	if !ok {
+		return "", false
+	}
+	for _, t := range ch.Templates {
+		if t.Name == rest {
+			return string(t.Data), true
+		}
+	}
+	for _, dep := range ch.Dependencies() {
+		if source, ok := findTemplate(dep, strings.TrimPrefix(rest, "charts/")); ok {
+			return source, true
+		}
+	}
+	return "", false
+}
+
+// templateSnippet returns the lines surrounding the given line number, with
+// line numbers, and the given line marked. If line is unknown, the whole
+// template is returned.
+func templateSnippet(lines []string, line int) string {
+	start, end := 0, len(lines)
+	if line > 0 && line <= len(lines) {
+		start = max(line-4, 0)
+		end = min(line+3, len(lines))
+	}
+	var sb strings.Builder
+	for i := start; i < end; i++ {
+		marker := " "
+		if i+1 == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&sb, "%s %4d | %s\n", marker, i+1, lines[i])
+	}
+	return sb.String()
+}
+
+// renderedTemplate returns the rendered output of the template with the given
+// name, from the manifest Helm returns when rendered templates are invalid.
+func renderedTemplate(manifest, name string) string {
+	header := "# Source: " + name + "\n"
+	_, rendered, ok := strings.Cut(manifest, header)
+	if !ok {
+		return ""
+	}
+	rendered, _, _ = strings.Cut(rendered, "\n---\n# Source: ")
+	return rendered
+}
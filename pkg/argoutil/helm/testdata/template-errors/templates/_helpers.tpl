@@ -0,0 +1,3 @@
+{{- define "template-errors.name" -}}
+{{ .Values.nested.name }}
+{{- end }}
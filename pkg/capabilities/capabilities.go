@@ -0,0 +1,252 @@
+package capabilities
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	"github.com/MacroPower/kclipper/pkg/argoutil/kube"
+)
+
+const (
+	// FileEnvVar is the environment variable containing the path to the
+	// capability profiles file.
+	FileEnvVar = "KCLX_CAPABILITIES_FILE"
+	// ProfileEnvVar is the environment variable containing the name of the
+	// capability profile to use when none is set explicitly.
+	ProfileEnvVar = "KCLX_CAPABILITIES_PROFILE"
+)
+
+var (
+	ErrNoProfilesFile  = errors.New("no capabilities file was provided")
+	ErrProfileNotFound = errors.New("capability profile not found")
+)
+
+// Profile describes the capabilities of a Kubernetes cluster, which are used
+// to populate `.Capabilities` when rendering Helm charts.
+type Profile struct {
+	// KubeVersion is the Kubernetes version of the cluster.
+	KubeVersion string `json:"kubeVersion,omitempty"`
+	// APIVersions are the API versions available in the cluster, in the form
+	// "group/version" or "group/version/Kind".
+	APIVersions []string `json:"apiVersions,omitempty"`
+	// APIVersionsFile is a path to a file containing additional API versions,
+	// relative to the profiles file. See [ParseAPIVersions] for the supported
+	// formats.
+	APIVersionsFile string `json:"apiVersionsFile,omitempty"`
+	// ClusterScopedKinds are the kinds of cluster-scoped resources available
+	// in the cluster, in the form "Kind.group" (or "Kind" for the core group),
+	// in addition to any in the [Profile.APIVersionsFile]'s discovery
+	// documents. They are used to decide which resources are namespaced.
+	ClusterScopedKinds []string `json:"clusterScopedKinds,omitempty"`
+}
+
+// Profiles is a collection of named capability [Profile]s.
+type Profiles struct {
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+var (
+	loadedProfiles   = map[string]*Profiles{}
+	loadedProfilesMu sync.Mutex
+)
+
+// LoadProfile returns the named [Profile] from the profiles file at the given
+// path. Each profiles file is only read once per process.
+func LoadProfile(path, name string) (*Profile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%w: set %s or the capabilities file explicitly", ErrNoProfilesFile, FileEnvVar)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve capabilities file path: %w", err)
+	}
+
+	loadedProfilesMu.Lock()
+	defer loadedProfilesMu.Unlock()
+
+	profiles, ok := loadedProfiles[absPath]
+	if !ok {
+		profiles, err = LoadFile(absPath)
+		if err != nil {
+			return nil, err
+		}
+		loadedProfiles[absPath] = profiles
+	}
+
+	return profiles.Get(name)
+}
+
+// LoadFile reads a YAML or JSON profiles file. Any [Profile.APIVersionsFile]
+// is read and merged into [Profile.APIVersions].
+func LoadFile(path string) (*Profiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capabilities file: %w", err)
+	}
+
+	profiles := &Profiles{}
+	if err := yaml.UnmarshalStrict(data, profiles); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal capabilities file '%s': %w", path, err)
+	}
+
+	for name, p := range profiles.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("capability profile '%s' is empty", name)
+		}
+		if p.APIVersionsFile == "" {
+			continue
+		}
+		avPath := p.APIVersionsFile
+		if !filepath.IsAbs(avPath) {
+			avPath = filepath.Join(filepath.Dir(path), avPath)
+		}
+		avData, err := os.ReadFile(avPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read api versions for capability profile '%s': %w", name, err)
+		}
+		apiVersions, err := ParseAPIVersions(avData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse api versions for capability profile '%s': %w", name, err)
+		}
+		p.APIVersions = append(p.APIVersions, apiVersions...)
+		p.ClusterScopedKinds = append(p.ClusterScopedKinds, ParseClusterScopedKinds(avData)...)
+	}
+
+	for _, p := range profiles.Profiles {
+		slices.Sort(p.APIVersions)
+		p.APIVersions = slices.Compact(p.APIVersions)
+		slices.Sort(p.ClusterScopedKinds)
+		p.ClusterScopedKinds = slices.Compact(p.ClusterScopedKinds)
+	}
+
+	return profiles, nil
+}
+
+// Get returns the [Profile] with the given name.
+func (p *Profiles) Get(name string) (*Profile, error) {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	return profile, nil
+}
+
+// ParseAPIVersions parses a list of API versions from either:
+//   - The output of `kubectl api-versions`, one API version per line.
+//   - One or more discovery documents, e.g. the output of `kubectl get --raw`
+//     for `/api` (APIVersions), `/apis` (APIGroupList), or `/apis/<group>/<version>`
+//     (APIResourceList). Resource lists also add "group/version/Kind" entries.
+func ParseAPIVersions(data []byte) ([]string, error) {
+	if apiVersions, ok := parseDiscovery(data); ok {
+		return apiVersions, nil
+	}
+
+	apiVersions := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		apiVersions = append(apiVersions, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read api versions: %w", err)
+	}
+
+	return apiVersions, nil
+}
+
+// parseDiscovery parses API versions from discovery documents. Returns false
+// if the data does not exclusively contain known discovery documents.
+func parseDiscovery(data []byte) ([]string, bool) {
+	docs, err := kube.SplitYAMLToString(data)
+	if err != nil || len(docs) == 0 {
+		return nil, false
+	}
+
+	apiVersions := []string{}
+	for _, doc := range docs {
+		typeMeta := metav1.TypeMeta{}
+		if err := yaml.Unmarshal([]byte(doc), &typeMeta); err != nil {
+			return nil, false
+		}
+
+		switch typeMeta.Kind {
+		case "APIVersions":
+			v := metav1.APIVersions{}
+			if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+				return nil, false
+			}
+			apiVersions = append(apiVersions, v.Versions...)
+		case "APIGroupList":
+			v := metav1.APIGroupList{}
+			if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+				return nil, false
+			}
+			for _, g := range v.Groups {
+				for _, gv := range g.Versions {
+					apiVersions = append(apiVersions, gv.GroupVersion)
+				}
+			}
+		case "APIResourceList":
+			v := metav1.APIResourceList{}
+			if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+				return nil, false
+			}
+			apiVersions = append(apiVersions, v.GroupVersion)
+			for _, r := range v.APIResources {
+				// Skip subresources, e.g. "deployments/status".
+				if strings.Contains(r.Name, "/") {
+					continue
+				}
+				apiVersions = append(apiVersions, v.GroupVersion+"/"+r.Kind)
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	return apiVersions, true
+}
+
+// ParseClusterScopedKinds returns the kinds of cluster-scoped resources in any
+// `APIResourceList` discovery documents, in the form "Kind.group" (or "Kind"
+// for the core group). Any other data is ignored.
+func ParseClusterScopedKinds(data []byte) []string {
+	docs, err := kube.SplitYAMLToString(data)
+	if err != nil {
+		return nil
+	}
+
+	kinds := []string{}
+	for _, doc := range docs {
+		v := metav1.APIResourceList{}
+		if err := yaml.Unmarshal([]byte(doc), &v); err != nil || v.Kind != "APIResourceList" {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(v.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range v.APIResources {
+			if r.Namespaced || strings.Contains(r.Name, "/") {
+				continue
+			}
+			kinds = append(kinds, schema.GroupKind{Group: gv.Group, Kind: r.Kind}.String())
+		}
+	}
+
+	return kinds
+}
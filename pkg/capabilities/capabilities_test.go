@@ -0,0 +1,140 @@
+package capabilities_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MacroPower/kclipper/pkg/capabilities"
+)
+
+func TestLoadProfile(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		want *capabilities.Profile
+		err  error
+	}{
+		"minimal": {
+			want: &capabilities.Profile{
+				KubeVersion: "v1.30.0",
+			},
+		},
+		"prod": {
+			want: &capabilities.Profile{
+				KubeVersion: "v1.31.2",
+				APIVersions: []string{
+					"admissionregistration.k8s.io/v1",
+					"apps/v1",
+					"batch/v1",
+					"monitoring.coreos.com/v1",
+					"networking.k8s.io/v1",
+					"policy/v1",
+					"v1",
+				},
+				APIVersionsFile:    "prod-api-versions.txt",
+				ClusterScopedKinds: []string{"ClusterIssuer.cert-manager.io"},
+			},
+		},
+		"staging": {
+			want: &capabilities.Profile{
+				KubeVersion: "v1.29.4",
+				APIVersions: []string{
+					"apps/v1",
+					"apps/v1/Deployment",
+					"autoscaling/v1",
+					"autoscaling/v2",
+					"rbac.authorization.k8s.io/v1",
+					"rbac.authorization.k8s.io/v1/ClusterRole",
+					"rbac.authorization.k8s.io/v1/Role",
+					"v1",
+				},
+				APIVersionsFile:    "staging-discovery.yaml",
+				ClusterScopedKinds: []string{"ClusterRole.rbac.authorization.k8s.io"},
+			},
+		},
+		"missing": {
+			err: capabilities.ErrProfileNotFound,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := capabilities.LoadProfile("testdata/profiles.yaml", name)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLoadProfileNoFile(t *testing.T) {
+	t.Parallel()
+
+	_, err := capabilities.LoadProfile("", "prod")
+	require.ErrorIs(t, err, capabilities.ErrNoProfilesFile)
+}
+
+func TestParseAPIVersions(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		input string
+		want  []string
+	}{
+		"api-versions": {
+			input: "apps/v1\n\n# comment\nv1\n",
+			want:  []string{"apps/v1", "v1"},
+		},
+		"api-versions-json": {
+			input: `{"kind":"APIVersions","versions":["v1"]}`,
+			want:  []string{"v1"},
+		},
+		"group-list-json": {
+			input: `{"kind":"APIGroupList","groups":[{"name":"batch","versions":[{"groupVersion":"batch/v1","version":"v1"}]}]}`,
+			want:  []string{"batch/v1"},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := capabilities.ParseAPIVersions([]byte(tc.input))
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestParseClusterScopedKinds(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		input string
+		want  []string
+	}{
+		"api-versions": {
+			input: "apps/v1\nv1\n",
+			want:  []string{},
+		},
+		"resource-list-json": {
+			input: `{"kind":"APIResourceList","groupVersion":"v1","resources":[` +
+				`{"name":"namespaces","namespaced":false,"kind":"Namespace"},` +
+				`{"name":"namespaces/status","namespaced":false,"kind":"Namespace"},` +
+				`{"name":"pods","namespaced":true,"kind":"Pod"}]}`,
+			want: []string{"Namespace"},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got := capabilities.ParseClusterScopedKinds([]byte(tc.input))
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+	"github.com/MacroPower/kclipper/pkg/argoutil/sync"
+)
+
+// checksumFragment is the URL fragment prefix of a packaged chart's expected
+// SHA-256 digest, e.g. "https://example.com/chart-1.0.0.tgz#sha256=<digest>".
+const checksumFragment = "#sha256="
+
+var (
+	ErrInvalidChecksum  = errors.New("invalid chart checksum")
+	ErrChecksumMismatch = errors.New("chart checksum mismatch")
+
+	archiveLock = sync.NewKeyLock()
+)
+
+// splitChecksum returns repoURL without any expected SHA-256 digest, and the
+// digest, if repoURL ends with a [checksumFragment].
+func splitChecksum(repoURL string) (string, string) {
+	if i := strings.LastIndex(repoURL, checksumFragment); i >= 0 {
+		return repoURL[:i], repoURL[i+len(checksumFragment):]
+	}
+	return repoURL, ""
+}
+
+// joinChecksum reverses [splitChecksum].
+func joinChecksum(repoURL, checksum string) string {
+	if checksum == "" {
+		return repoURL
+	}
+	return repoURL + checksumFragment + checksum
+}
+
+// isArchiveURL returns true if repoURL is the HTTP(S) URL of a packaged chart.
+func isArchiveURL(repoURL string) bool {
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return isChartArchive(u.Path)
+}
+
+// validateChecksum returns an error if checksum is not a hex-encoded SHA-256
+// digest.
+func validateChecksum(checksum string) error {
+	if b, err := hex.DecodeString(checksum); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("%w '%s': expected a hex-encoded SHA-256 digest", ErrInvalidChecksum, checksum)
+	}
+	return nil
+}
+
+// verifyChecksum returns an error if checksum is set and does not match the
+// SHA-256 digest of data.
+func verifyChecksum(name string, data []byte, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, checksum) {
+		return fmt.Errorf("%w for %s: expected sha256 %s, got %s", ErrChecksumMismatch, name, checksum, actual)
+	}
+	return nil
+}
+
+// verifyFileChecksum runs [verifyChecksum] on the contents of the file at path.
+func verifyFileChecksum(path, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read chart archive: %w", err)
+	}
+	return verifyChecksum(path, data, checksum)
+}
+
+// pullArchive downloads the packaged chart at the given HTTP(S) URL, and
+// verifies its SHA-256 digest if checksum is set. If keyring is set, the
+// chart's provenance file (i.e. the URL + ".prov") is downloaded and verified
+// using the keyring. Downloaded charts are stored in the injected
+// [PathCacher] once verified, and subsequent requests will use [PathCacher]
+// rather than re-downloading the chart.
+func (c *Client) pullArchive(
+	archiveURL, checksum string, creds Creds, keyring string, extract bool,
+) (string, io.Closer, error) {
+	key := map[string]string{
+		"url":     archiveURL,
+		"version": strings.ToLower(checksum),
+		"project": c.cacheProject(creds),
+	}
+	if keyring != "" {
+		digest, err := argohelm.KeyringDigest(keyring)
+		if err != nil {
+			return "", nil, err
+		}
+		key["keyring"] = digest
+	}
+	keyData, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal cache key data: %w", err)
+	}
+	cachedPath, err := c.Paths.GetPath(string(keyData))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get chart cache path: %w", err)
+	}
+
+	archiveLock.Lock(cachedPath)
+	defer archiveLock.Unlock(cachedPath)
+
+	if !fileExists(cachedPath) {
+		data, err := c.downloadFile(archiveURL, creds)
+		if err != nil {
+			return "", nil, fmt.Errorf("error downloading helm chart: %w", err)
+		}
+		if err := verifyChecksum(archiveURL, data, checksum); err != nil {
+			return "", nil, err
+		}
+		if keyring != "" {
+			provData, err := c.downloadFile(archiveURL+".prov", creds)
+			if err != nil {
+				return "", nil, fmt.Errorf("error downloading provenance file: %w", err)
+			}
+			u, err := url.Parse(archiveURL)
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to parse URL '%s': %w", archiveURL, err)
+			}
+			if err := verifyProvenanceData(u.Path, data, provData, keyring); err != nil {
+				return "", nil, err
+			}
+		}
+		if err := writeCacheFile(cachedPath, "chart", data); err != nil {
+			return "", nil, err
+		}
+		if err := c.sealCachedPath(cachedPath); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return c.openArchive(cachedPath, extract)
+}
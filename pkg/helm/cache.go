@@ -1,12 +1,25 @@
 package helm
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 )
 
+// SecureCacheEnvVar is the environment variable which, when set to "true",
+// makes [DefaultClient] use [SecureTempPaths] rather than [TempPaths].
+const SecureCacheEnvVar = "KCLX_HELM_SECURE_CACHE"
+
+var ErrUntrustedCache = errors.New("untrusted chart cache")
+
 type PathEncoder interface {
 	Encode(key string) string
 	Decode(key string) (string, error)
@@ -79,6 +92,253 @@ func (p *TempPaths) GetPaths() map[string]string {
 	return paths
 }
 
+// SecureTempPaths is a [TempPaths] which is hardened for multi-tenant
+// environments, e.g. an Argo CD repo server shared by several Projects:
+//   - Each Project has its own cache root, which is only accessible by the
+//     current user.
+//   - The SHA-256 digest of each cached file is stored when it is written (see
+//     [SecureTempPaths.Seal]), and verified whenever it is read. Files which do
+//     not match their digest are removed, so they will be pulled again.
+//   - Cache directories and files which are not owned by the current user, or
+//     which other users can write to, are refused.
+type SecureTempPaths struct {
+	*TempPaths
+	digests string
+}
+
+// NewSecureTempPaths returns a new [SecureTempPaths] for the given Project,
+// storing files in a directory within root that is specific to the current
+// user and Project.
+func NewSecureTempPaths(root, project string, pe PathEncoder) (*SecureTempPaths, error) {
+	root = filepath.Clean(root)
+	projectRoot := filepath.Join(root, "kclipper-"+strconv.Itoa(os.Getuid()), "projects", "_"+pe.Encode(project))
+	chartPaths := filepath.Join(projectRoot, "charts")
+	digestPaths := filepath.Join(projectRoot, "digests")
+	for _, dir := range []string{chartPaths, digestPaths} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create chart cache directory: %w", err)
+		}
+	}
+	dirs := []string{digestPaths}
+	for dir := chartPaths; dir != root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		if err := checkCacheDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SecureTempPaths{
+		TempPaths: &TempPaths{
+			root: chartPaths,
+			pe:   pe,
+		},
+		digests: digestPaths,
+	}, nil
+}
+
+// MustNewSecureTempPaths runs [NewSecureTempPaths] and panics on any errors.
+func MustNewSecureTempPaths(root, project string, pe PathEncoder) *SecureTempPaths {
+	p, err := NewSecureTempPaths(root, project, pe)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// LazySecureTempPaths is a [SecureTempPaths] which is created when it is first
+// used, rather than when it is constructed. Any error creating it, e.g. an
+// untrusted cache root, is returned by GetPath and Seal.
+type LazySecureTempPaths struct {
+	paths   *SecureTempPaths
+	err     error
+	pe      PathEncoder
+	root    string
+	project string
+	once    sync.Once
+}
+
+// NewLazySecureTempPaths returns a new [LazySecureTempPaths], which runs
+// [NewSecureTempPaths] with the given arguments when it is first used.
+func NewLazySecureTempPaths(root, project string, pe PathEncoder) *LazySecureTempPaths {
+	return &LazySecureTempPaths{root: root, project: project, pe: pe}
+}
+
+func (p *LazySecureTempPaths) get() (*SecureTempPaths, error) {
+	p.once.Do(func() {
+		p.paths, p.err = NewSecureTempPaths(p.root, p.project, p.pe)
+	})
+	return p.paths, p.err
+}
+
+func (p *LazySecureTempPaths) Add(key string, value string) {
+	if paths, err := p.get(); err == nil {
+		paths.Add(key, value)
+	}
+}
+
+// GetPath runs [SecureTempPaths.GetPath].
+func (p *LazySecureTempPaths) GetPath(key string) (string, error) {
+	paths, err := p.get()
+	if err != nil {
+		return "", err
+	}
+	return paths.GetPath(key)
+}
+
+// GetPathIfExists runs [SecureTempPaths.GetPathIfExists].
+func (p *LazySecureTempPaths) GetPathIfExists(key string) string {
+	paths, err := p.get()
+	if err != nil {
+		return ""
+	}
+	return paths.GetPathIfExists(key)
+}
+
+// GetPaths runs [SecureTempPaths.GetPaths].
+func (p *LazySecureTempPaths) GetPaths() map[string]string {
+	paths, err := p.get()
+	if err != nil {
+		return map[string]string{}
+	}
+	return paths.GetPaths()
+}
+
+// Seal runs [SecureTempPaths.Seal].
+func (p *LazySecureTempPaths) Seal(path string) error {
+	paths, err := p.get()
+	if err != nil {
+		return err
+	}
+	return paths.Seal(path)
+}
+
+// GetPath generates a path for the given key. If a file already exists at the
+// path, it is verified before the path is returned.
+func (p *SecureTempPaths) GetPath(key string) (string, error) {
+	path := p.keyToPath(key)
+	if err := p.verify(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// GetPathIfExists gets a path for the given key if it exists and is verified.
+// Otherwise, returns an empty string.
+func (p *SecureTempPaths) GetPathIfExists(key string) string {
+	path, err := p.GetPath(key)
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// Seal stores the digest of the file at path, which must have been returned by
+// [SecureTempPaths.GetPath].
+func (p *SecureTempPaths) Seal(path string) error {
+	if filepath.Dir(path) != p.root {
+		return fmt.Errorf("%w: %s is not in %s", ErrUntrustedCache, path, p.root)
+	}
+	if err := checkCacheFile(path); err != nil {
+		return err
+	}
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	if err := writeCacheFile(p.digestPath(path), "digest", []byte(digest)); err != nil {
+		return fmt.Errorf("failed to write chart cache digest: %w", err)
+	}
+	return nil
+}
+
+// verify returns an error if the file at path is not owned by the current
+// user, or can be written by other users. If the file does not match its
+// stored digest, it is removed.
+func (p *SecureTempPaths) verify(path string) error {
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := checkCacheFile(path); err != nil {
+		return err
+	}
+
+	digestPath := p.digestPath(path)
+	expected, err := os.ReadFile(digestPath)
+	if err == nil {
+		if err := checkCacheFile(digestPath); err != nil {
+			return err
+		}
+		var actual string
+		actual, err = fileDigest(path)
+		if err == nil && actual == string(bytes.TrimSpace(expected)) {
+			return nil
+		}
+	}
+
+	// The file was not sealed, or has been modified since.
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove unverified chart cache file: %w", err)
+	}
+	_ = os.Remove(digestPath)
+	return nil
+}
+
+func (p *SecureTempPaths) digestPath(path string) string {
+	return filepath.Join(p.digests, filepath.Base(path))
+}
+
+// checkCacheDir returns an error if path is not a directory owned by the
+// current user, or if it can be accessed by other users.
+func checkCacheDir(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat chart cache directory: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrUntrustedCache, path)
+	}
+	if !ownedByCurrentUser(fi) {
+		return fmt.Errorf("%w: %s is not owned by the current user", ErrUntrustedCache, path)
+	}
+	if fi.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%w: %s can be accessed by other users", ErrUntrustedCache, path)
+	}
+	return nil
+}
+
+// checkCacheFile returns an error if path is not a regular file owned by the
+// current user, or if it can be written by other users.
+func checkCacheFile(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat chart cache file: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s is not a regular file", ErrUntrustedCache, path)
+	}
+	if !ownedByCurrentUser(fi) {
+		return fmt.Errorf("%w: %s is not owned by the current user", ErrUntrustedCache, path)
+	}
+	if fi.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%w: %s can be written by other users", ErrUntrustedCache, path)
+	}
+	return nil
+}
+
+func fileDigest(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read chart cache file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 type Base64PathEncoder struct{}
 
 func NewBase64PathEncoder() *Base64PathEncoder {
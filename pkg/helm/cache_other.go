@@ -0,0 +1,13 @@
+//go:build !unix
+
+package helm
+
+import (
+	"io/fs"
+)
+
+// ownedByCurrentUser always returns true, since file ownership is only
+// checked on Unix systems.
+func ownedByCurrentUser(_ fs.FileInfo) bool {
+	return true
+}
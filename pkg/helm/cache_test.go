@@ -0,0 +1,171 @@
+package helm_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/MacroPower/kclipper/pkg/helm"
+	"github.com/MacroPower/kclipper/pkg/pathutil"
+)
+
+func TestSecureTempPaths(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	paths, err := helm.NewSecureTempPaths(root, "a", helm.NewBase64PathEncoder())
+	require.NoError(t, err)
+
+	write := func(data string) string {
+		t.Helper()
+		path, err := paths.GetPath("key")
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+
+	// Sealed files are returned.
+	path := write("data")
+	require.NoError(t, paths.Seal(path))
+	require.Equal(t, path, paths.GetPathIfExists("key"))
+	require.Equal(t, map[string]string{"key": path}, paths.GetPaths())
+
+	// Modified files are removed.
+	write("modified")
+	require.Empty(t, paths.GetPathIfExists("key"))
+	require.NoFileExists(t, path)
+
+	// Unsealed files are removed.
+	write("unsealed")
+	require.Empty(t, paths.GetPathIfExists("key"))
+	require.NoFileExists(t, path)
+
+	// Files which other users can write to are refused.
+	write("data")
+	require.NoError(t, paths.Seal(path))
+	require.NoError(t, os.Chmod(path, 0o666))
+	_, err = paths.GetPath("key")
+	require.ErrorIs(t, err, helm.ErrUntrustedCache)
+	require.NoError(t, os.Remove(path))
+
+	// Symlinks are refused.
+	target := filepath.Join(t.TempDir(), "target")
+	require.NoError(t, os.WriteFile(target, []byte("data"), 0o600))
+	require.NoError(t, os.Symlink(target, path))
+	_, err = paths.GetPath("key")
+	require.ErrorIs(t, err, helm.ErrUntrustedCache)
+	require.ErrorIs(t, paths.Seal(path), helm.ErrUntrustedCache)
+	require.NoError(t, os.Remove(path))
+
+	// Only paths returned by GetPath can be sealed.
+	require.ErrorIs(t, paths.Seal(target), helm.ErrUntrustedCache)
+
+	// Each Project has its own cache root.
+	otherPaths, err := helm.NewSecureTempPaths(root, "b", helm.NewBase64PathEncoder())
+	require.NoError(t, err)
+	otherPath, err := otherPaths.GetPath("key")
+	require.NoError(t, err)
+	require.NotEqual(t, filepath.Dir(path), filepath.Dir(otherPath))
+
+	// Cache roots which other users can access are refused.
+	require.NoError(t, os.Chmod(filepath.Join(root, "kclipper-"+strconv.Itoa(os.Getuid())), 0o755))
+	_, err = helm.NewSecureTempPaths(root, "a", helm.NewBase64PathEncoder())
+	require.ErrorIs(t, err, helm.ErrUntrustedCache)
+}
+
+func TestLazySecureTempPaths(t *testing.T) {
+	t.Parallel()
+
+	// An untrusted cache root, e.g. created by another user.
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "kclipper-"+strconv.Itoa(os.Getuid())), 0o777))
+	require.NoError(t, os.Chmod(filepath.Join(root, "kclipper-"+strconv.Itoa(os.Getuid())), 0o777))
+
+	var paths helm.PathCacher = helm.NewLazySecureTempPaths(root, "test", helm.NewBase64PathEncoder())
+	client := helm.MustNewClient(paths, "test", "10M")
+
+	// Errors are returned when the cache is used.
+	_, err := paths.GetPath("key")
+	require.ErrorIs(t, err, helm.ErrUntrustedCache)
+	require.Empty(t, paths.GetPathIfExists("key"))
+	require.Empty(t, paths.GetPaths())
+
+	_, err = helm.NewChart(client, helm.TemplateOpts{
+		ChartName:      "simple-chart",
+		TargetRevision: "0.1.0",
+		RepoURL:        "https://example.invalid/charts",
+	}).Template()
+	require.ErrorIs(t, err, helm.ErrUntrustedCache)
+
+	// Trusted cache roots are created when first used.
+	paths = helm.NewLazySecureTempPaths(t.TempDir(), "test", helm.NewBase64PathEncoder())
+	path, err := paths.GetPath("key")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+	sealer, ok := paths.(pathutil.Sealer)
+	require.True(t, ok)
+	require.NoError(t, sealer.Seal(path))
+	require.Equal(t, path, paths.GetPathIfExists("key"))
+}
+
+func TestHelmChartSecureCache(t *testing.T) {
+	t.Parallel()
+
+	ch, err := loader.Load("testdata/simple-chart")
+	require.NoError(t, err)
+	archivePath, err := chartutil.Save(ch, t.TempDir())
+	require.NoError(t, err)
+	data, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	paths, err := helm.NewSecureTempPaths(t.TempDir(), "test", helm.NewBase64PathEncoder())
+	require.NoError(t, err)
+	client := helm.MustNewClient(paths, "test", "10M")
+
+	opts := helm.TemplateOpts{
+		ChartName:   "simple-chart",
+		RepoURL:     srv.URL + "/simple-chart-0.1.0.tgz",
+		Credentials: helm.Creds{Username: "user", Password: "pass"},
+	}
+	for range 2 {
+		_, err := helm.NewChart(client, opts).Template()
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 1, requests.Load())
+
+	// Charts pulled with credentials are not shared with other credentials.
+	noCredsOpts := opts
+	noCredsOpts.Credentials = helm.Creds{}
+	_, err = helm.NewChart(client, noCredsOpts).Template()
+	require.ErrorContains(t, err, "401 Unauthorized")
+	require.EqualValues(t, 2, requests.Load())
+
+	// Modified charts are pulled again.
+	cached := paths.GetPaths()
+	require.Len(t, cached, 1)
+	for _, path := range cached {
+		require.NoError(t, os.WriteFile(path, []byte("poisoned"), 0o600))
+	}
+	_, err = helm.NewChart(client, opts).Template()
+	require.NoError(t, err)
+	require.EqualValues(t, 3, requests.Load())
+}
@@ -1,20 +1,67 @@
 package helm
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
-	"github.com/MacroPower/kclipper/pkg/argoutil/kube"
+)
+
+var (
+	ErrInvalidKubeVersion = errors.New("invalid kube version")
+	ErrInvalidAPIVersion  = errors.New("invalid api version")
+
+	ErrInvalidChartFilePath = errors.New("chart file path must be relative to and within the chart")
+	ErrRepoURLOutsideRoot   = errors.New("local chart repository must be within the repository root")
+
+	// readmeFileNames are the README file names recognized by `helm show readme`,
+	// in order of precedence.
+	readmeFileNames = []string{"readme.md", "readme.txt", "readme"}
+
+	apiVersionRegexp = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]+)?$`)
+	apiGroupRegexp   = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	apiKindRegexp    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
 )
 
 type Chart struct {
 	Client       ChartClient
 	TemplateOpts TemplateOpts
+	// RenderCache is an optional cache of manifests rendered by
+	// [Chart.Template]. See [WithRenderCache].
+	RenderCache *RenderCache
+	// ChartCache is an optional in-memory cache of loaded charts. See
+	// [WithChartCache].
+	ChartCache *argohelm.ChartCache
+}
+
+type ChartOpts func(c *Chart)
+
+// WithChartCache enables loading charts using the given [argohelm.ChartCache],
+// so that a chart rendered many times is only loaded once.
+func WithChartCache(cc *argohelm.ChartCache) ChartOpts {
+	return func(c *Chart) {
+		c.ChartCache = cc
+	}
+}
+
+// WithRenderCache enables caching the manifests rendered by [Chart.Template]
+// in the given [RenderCache]. Entries are keyed by the chart's digest and all
+// [TemplateOpts] which affect Helm's output, so cached output is returned
+// without invoking the Helm engine.
+func WithRenderCache(rc *RenderCache) ChartOpts {
+	return func(c *Chart) {
+		c.RenderCache = rc
+	}
 }
 
 type TemplateOpts struct {
@@ -33,60 +80,323 @@ type TemplateOpts struct {
 	Proxy                string
 	NoProxy              string
 	SkipSchemaValidation bool
+	StrictCompatibility  bool
+	IncludeHooks         bool
+	SkipTests            bool
+	ShowOnly             []string
+	Patches              []Patch
+	// LookupObjects are returned by Helm's `lookup` template function, as if
+	// they existed in the cluster. See [LoadLookupObjects].
+	LookupObjects []map[string]any
+	// ValueFiles are merged in order, and then overridden by ValuesObject. Each
+	// is either an HTTP(S) URL, a local path, or a path within the chart.
+	// Relative local paths are resolved from RepoRoot, if it is set.
+	ValueFiles []string
+	// IgnoreMissingValueFiles skips any ValueFiles that do not exist.
+	IgnoreMissingValueFiles bool
+	// Set, SetString and SetFile are overrides in the format of Helm's
+	// `--set`, `--set-string` and `--set-file` flags (e.g. "a.b[0].c=value"),
+	// which are applied in order after ValuesObject. SetFile paths are
+	// resolved in the same way as local ValueFiles.
+	Set       []string
+	SetString []string
+	SetFile   []string
+	// ShowTemplateOnError adds the offending template to any
+	// [argohelm.TemplateError] returned when rendering the chart.
+	ShowTemplateOnError bool
+	// InjectNamespace sets Namespace on each namespaced object which does not
+	// already have a namespace. See [InjectNamespace].
+	InjectNamespace bool
+	// ClusterScopedKinds are additional cluster-scoped kinds, in the form
+	// "Kind.group", used by InjectNamespace.
+	ClusterScopedKinds []string
+	// FlattenLists replaces `List` objects with their items. See [FlattenLists].
+	FlattenLists bool
+	// DropEmpty removes documents without any fields, e.g. `{}`, which are
+	// otherwise invalid objects.
+	DropEmpty bool
+	// SortInstallOrder sorts objects in the order Helm installs them. See
+	// [SortInstallOrder].
+	SortInstallOrder bool
+	// CRDPlacement controls where CustomResourceDefinitions are placed.
+	CRDPlacement CRDPlacement
+	// ValidateValuesSchema validates the values against the values schema of
+	// the chart and any sub charts in Go, before rendering the chart. This is
+	// typically used with SkipSchemaValidation. See [ValuesSchemaError].
+	ValidateValuesSchema bool
+	// RepoRoot is the directory that relative local RepoURLs, ValueFiles and
+	// SetFiles are resolved from, typically the KCL module root. When set,
+	// local repositories, charts and files must be within RepoRoot.
+	// Otherwise, relative paths are resolved from the current working
+	// directory.
+	RepoRoot string
+	// Path is the path of the chart within a git repository, i.e. when
+	// RepoURL is prefixed with "git+" (e.g. "git+https://host/org/repo.git"
+	// or "git+file:///path/to/repo"). Defaults to the repository root. For git
+	// repositories, TargetRevision is a branch, tag or commit SHA.
+	Path string
+	// PostRendererExec is an executable which modifies the rendered manifests,
+	// like Helm's `--post-renderer`. Charts using a post-renderer are not
+	// cached in the [RenderCache], since the output of the executable is not
+	// known.
+	PostRendererExec *PostRendererExec
+	// Keyring is the path of a keyring used to verify the chart's provenance
+	// file (--verify --keyring). When set, the chart must have a valid
+	// provenance file signed by a key in the keyring, or pulling it fails.
+	// Relative paths are resolved from RepoRoot, if it is set. Provenance is
+	// only supported for charts pulled from repositories, OCI registries,
+	// archive URLs and local packaged charts.
+	Keyring string
+}
+
+// Release is a Helm release rendered by [Chart.Release].
+type Release struct {
+	Resources []*unstructured.Unstructured `json:"resources"`
+	Notes     string                       `json:"notes"`
+	Chart     ReleaseChart                 `json:"chart"`
+	Values    map[string]any               `json:"values"`
+	// CRDs are the rendered CustomResourceDefinitions, when they are returned
+	// separately using [CRDPlacementSeparate].
+	CRDs []*unstructured.Unstructured `json:"crds,omitempty"`
+}
+
+// ReleaseChart describes a chart used by a [Release].
+type ReleaseChart struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"appVersion"`
+	// Dependencies are the chart's enabled dependencies.
+	Dependencies []ReleaseChart `json:"dependencies"`
+}
+
+func newReleaseChart(ch *chart.Chart) ReleaseChart {
+	rc := ReleaseChart{
+		Name:         ch.Metadata.Name,
+		Version:      ch.Metadata.Version,
+		AppVersion:   ch.Metadata.AppVersion,
+		Dependencies: []ReleaseChart{},
+	}
+	for _, d := range ch.Dependencies() {
+		rc.Dependencies = append(rc.Dependencies, newReleaseChart(d))
+	}
+	return rc
 }
 
 type ChartClient interface {
 	PullWithCreds(
 		chart, repoURL, targetRevision string,
 		creds Creds,
+		keyring string,
 		extract, passCredentials bool,
 	) (string, io.Closer, error)
+	PullValueFile(fileURL string, creds Creds) ([]byte, error)
+	PullSchemaRef(refURL string) ([]byte, error)
+	BuildDependencies(chartPath string, opts DependencyOpts) (string, io.Closer, error)
+	PinOCIRevision(chart, repoURL, targetRevision string, creds Creds) (string, error)
 }
 
 type JSONSchemaGenerator interface {
 	FromPaths(paths ...string) ([]byte, error)
 }
 
-func NewChart(client ChartClient, opts TemplateOpts) *Chart {
-	return &Chart{
+func NewChart(client ChartClient, opts TemplateOpts, chartOpts ...ChartOpts) *Chart {
+	c := &Chart{
 		Client:       client,
 		TemplateOpts: opts,
 	}
+	for _, opt := range chartOpts {
+		opt(c)
+	}
+	return c
 }
 
 // Template pulls a Helm chart using the provided [TemplateOpts], and then
 // executes `helm template` to render the chart. The rendered output is then
-// split into individual Kubernetes objects and returned as a slice of
+// split into individual Kubernetes objects, normalized, namespaced if
+// [TemplateOpts.InjectNamespace] is set, patched with any
+// [TemplateOpts.Patches], and returned as a slice of
 // [unstructured.Unstructured] objects.
 func (c *Chart) Template() ([]*unstructured.Unstructured, error) {
-	out, err := c.template()
+	chartPath, closer, err := c.pull()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = closer.Close()
+	}()
+
+	values, err := c.values(chartPath)
 	if err != nil {
 		return nil, err
 	}
+	if c.TemplateOpts.ValidateValuesSchema {
+		if err := c.validateValues(chartPath, values); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest, err := c.templateManifest(chartPath, values)
+	if err != nil {
+		return nil, err
+	}
+
+	crds, objs, err := c.objects(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(crds, objs...), nil
+}
+
+// objects splits the rendered manifest into individual Kubernetes objects, and
+// then normalizes and patches them according to the [TemplateOpts]. If
+// [TemplateOpts.CRDPlacement] is set, CRDs are returned separately from all
+// other objects.
+func (c *Chart) objects(manifest string) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+	opts := &c.TemplateOpts
+
+	objs, err := splitManifest(manifest, opts.DropEmpty)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing helm template output: %w", err)
+	}
+
+	if opts.FlattenLists {
+		objs, err = FlattenLists(objs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error flattening helm template output: %w", err)
+		}
+	}
+
+	if opts.InjectNamespace {
+		InjectNamespace(objs, opts.Namespace, opts.ClusterScopedKinds)
+	}
+
+	objs, err = ApplyPatches(objs, opts.Patches)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error patching helm template output: %w", err)
+	}
+
+	if opts.SortInstallOrder {
+		SortInstallOrder(objs)
+	}
+
+	if opts.CRDPlacement == CRDPlacementInline {
+		return nil, objs, nil
+	}
+	crds, objs := SplitCRDs(objs)
+
+	return crds, objs, nil
+}
+
+// templateManifest renders the chart at chartPath with the given values, using
+// the [RenderCache] if one is configured.
+func (c *Chart) templateManifest(chartPath string, values map[string]any) (string, error) {
+	if c.RenderCache == nil || c.TemplateOpts.PostRendererExec != nil {
+		rel, err := c.render(chartPath, values)
+		if err != nil {
+			return "", err
+		}
+		return rel.Manifest, nil
+	}
+
+	key, err := renderCacheKey(chartPath, &c.TemplateOpts, values)
+	if err != nil {
+		return "", fmt.Errorf("error computing render cache key: %w", err)
+	}
+	if manifest, ok := c.RenderCache.Get(key); ok {
+		return manifest, nil
+	}
 
-	objs, err := kube.SplitYAML(out)
+	rel, err := c.render(chartPath, values)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing helm template output: %w", err)
+		return "", err
+	}
+	if err := c.RenderCache.Put(key, rel.Manifest); err != nil {
+		slog.Warn("failed to write render cache", "chart", c.TemplateOpts.ChartName, "err", err)
 	}
 
-	return objs, nil
+	return rel.Manifest, nil
 }
 
-func (c *Chart) template() ([]byte, error) {
-	chartPath, closer, err := c.Client.PullWithCreds(c.TemplateOpts.ChartName, c.TemplateOpts.RepoURL,
-		c.TemplateOpts.TargetRevision, c.TemplateOpts.Credentials, false, c.TemplateOpts.PassCredentials)
+// Release pulls and renders a Helm chart in the same way as [Chart.Template],
+// and returns the rendered objects along with the release's notes, chart
+// information, and the fully coalesced values used by Helm. CRDs are returned
+// in [Release.CRDs] if [TemplateOpts.CRDPlacement] is [CRDPlacementSeparate].
+func (c *Chart) Release() (*Release, error) {
+	chartPath, closer, err := c.pull()
 	if err != nil {
-		return nil, fmt.Errorf("error pulling helm chart: %w", err)
+		return nil, err
 	}
 	defer func() {
 		_ = closer.Close()
 	}()
 
+	values, err := c.values(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	if c.TemplateOpts.ValidateValuesSchema {
+		if err := c.validateValues(chartPath, values); err != nil {
+			return nil, err
+		}
+	}
+
+	rel, err := c.render(chartPath, values)
+	if err != nil {
+		return nil, err
+	}
+
+	crds, objs, err := c.objects(rel.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	if c.TemplateOpts.CRDPlacement != CRDPlacementSeparate {
+		objs = append(crds, objs...)
+		crds = nil
+	}
+
+	return &Release{
+		Resources: objs,
+		CRDs:      crds,
+		Notes:     rel.Notes,
+		Chart:     newReleaseChart(rel.Chart),
+		Values:    rel.Values,
+	}, nil
+}
+
+// pull validates the [TemplateOpts], and then pulls the Helm chart for
+// rendering. The returned [io.Closer] cleans up the pulled chart.
+func (c *Chart) pull() (string, io.Closer, error) {
+	if err := validateKubeVersion(c.TemplateOpts.KubeVersion); err != nil {
+		return "", nil, err
+	}
+	if err := validateAPIVersions(c.TemplateOpts.APIVersions); err != nil {
+		return "", nil, err
+	}
+	if err := validateCRDPlacement(c.TemplateOpts.CRDPlacement); err != nil {
+		return "", nil, err
+	}
+
+	chartName, repoURL, err := c.source()
+	if err != nil {
+		return "", nil, err
+	}
+	chartPath, closer, err := c.Client.PullWithCreds(chartName, repoURL,
+		c.TemplateOpts.TargetRevision, c.TemplateOpts.Credentials, c.keyring(), false, c.TemplateOpts.PassCredentials)
+	if err != nil {
+		return "", nil, fmt.Errorf("error pulling helm chart: %w", err)
+	}
+	return chartPath, closer, nil
+}
+
+// render renders the Helm chart at chartPath with the given values, building
+// any missing chart dependencies.
+func (c *Chart) render(chartPath string, values map[string]any) (*argohelm.Release, error) {
 	// isLocal controls helm temp dirs, does not seem to impact pull/template behavior.
 	isLocal := false
 
-	ha, err := argohelm.NewHelmApp(chartPath, c.TemplateOpts.Repositories, isLocal, "v3",
-		c.TemplateOpts.Proxy, c.TemplateOpts.NoProxy, c.TemplateOpts.PassCredentials)
+	ha, err := argohelm.NewHelmApp(chartPath, isLocal, "v3", c.TemplateOpts.Proxy, c.TemplateOpts.NoProxy,
+		argohelm.WithChartCache(c.ChartCache))
 	if err != nil {
 		return nil, fmt.Errorf("error initializing helm app object: %w", err)
 	}
@@ -95,26 +405,251 @@ func (c *Chart) template() ([]byte, error) {
 	argoTemplateOpts := &argohelm.TemplateOpts{
 		Name:                 c.TemplateOpts.ChartName,
 		Namespace:            c.TemplateOpts.Namespace,
-		Values:               c.TemplateOpts.ValuesObject,
+		Values:               values,
 		SkipCrds:             c.TemplateOpts.SkipCRDs,
 		KubeVersion:          c.TemplateOpts.KubeVersion,
 		APIVersions:          c.TemplateOpts.APIVersions,
 		SkipSchemaValidation: c.TemplateOpts.SkipSchemaValidation,
+		StrictCompatibility:  c.TemplateOpts.StrictCompatibility,
+		IncludeHooks:         c.TemplateOpts.IncludeHooks,
+		SkipTests:            c.TemplateOpts.SkipTests,
+		ShowOnly:             c.TemplateOpts.ShowOnly,
+		LookupObjects:        c.TemplateOpts.LookupObjects,
+		ShowTemplateOnError:  c.TemplateOpts.ShowTemplateOnError,
+	}
+	if c.TemplateOpts.PostRendererExec != nil {
+		argoTemplateOpts.PostRenderer = c.TemplateOpts.PostRendererExec
 	}
-	out, _, err := ha.Template(argoTemplateOpts)
+	rel, err := ha.Release(argoTemplateOpts)
 	if err != nil {
 		if !argohelm.IsMissingDependencyErr(err) {
 			return nil, fmt.Errorf("error templating helm chart: %w", err)
 		}
-		if err = ha.DependencyBuild(); err != nil {
+		builtPath, builtCloser, err := c.Client.BuildDependencies(chartPath, DependencyOpts{
+			RepoURL:         c.TemplateOpts.RepoURL,
+			Credentials:     c.TemplateOpts.Credentials,
+			PassCredentials: c.TemplateOpts.PassCredentials,
+			Repositories:    c.TemplateOpts.Repositories,
+		})
+		if err != nil {
 			return nil, fmt.Errorf("error building helm dependencies: %w", err)
 		}
-		out, _, err = ha.Template(argoTemplateOpts)
+		defer func() {
+			_ = builtCloser.Close()
+		}()
+
+		hb, err := argohelm.NewHelmApp(builtPath, isLocal, "v3", c.TemplateOpts.Proxy, c.TemplateOpts.NoProxy,
+			argohelm.WithChartCache(c.ChartCache))
+		if err != nil {
+			return nil, fmt.Errorf("error initializing helm app object: %w", err)
+		}
+		defer hb.Dispose()
+
+		rel, err = hb.Release(argoTemplateOpts)
 		if err != nil {
 			return nil, fmt.Errorf("error templating helm chart: %w", err)
 		}
 	}
-	return []byte(out), nil
+	return rel, nil
+}
+
+// GetChartMetadata pulls a Helm chart using the provided [TemplateOpts], and
+// returns the metadata defined in the chart's Chart.yaml.
+func (c *Chart) GetChartMetadata() (*chart.Metadata, error) {
+	chartPath, closer, err := c.pullExtracted()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = closer.Close()
+	}()
+
+	md, err := chartutil.LoadChartfile(filepath.Join(chartPath, chartutil.ChartfileName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading chart metadata: %w", err)
+	}
+
+	return md, nil
+}
+
+// ShowValues pulls a Helm chart using the provided [TemplateOpts], and returns
+// the chart's default values, defined in its values.yaml (like `helm show
+// values`). An empty map is returned if the chart has no values.yaml.
+func (c *Chart) ShowValues() (map[string]any, error) {
+	chartPath, closer, err := c.pullExtracted()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = closer.Close()
+	}()
+
+	valuesPath := filepath.Join(chartPath, chartutil.ValuesfileName)
+	if _, err := os.Stat(valuesPath); errors.Is(err, os.ErrNotExist) {
+		return map[string]any{}, nil
+	}
+	values, err := chartutil.ReadValuesFile(valuesPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading chart values: %w", err)
+	}
+
+	return values.AsMap(), nil
+}
+
+// ShowReadme pulls a Helm chart using the provided [TemplateOpts], and returns
+// the contents of the chart's README (like `helm show readme`). An empty string
+// is returned if the chart has no README.
+func (c *Chart) ShowReadme() (string, error) {
+	chartPath, closer, err := c.pullExtracted()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = closer.Close()
+	}()
+
+	entries, err := os.ReadDir(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading helm chart directory: %w", err)
+	}
+	for _, n := range readmeFileNames {
+		for _, e := range entries {
+			if e.IsDir() || !strings.EqualFold(e.Name(), n) {
+				continue
+			}
+			readme, err := os.ReadFile(filepath.Join(chartPath, e.Name()))
+			if err != nil {
+				return "", fmt.Errorf("error reading chart readme: %w", err)
+			}
+			return string(readme), nil
+		}
+	}
+
+	return "", nil
+}
+
+// ReadFile pulls a Helm chart using the provided [TemplateOpts], and returns
+// the contents of the file at the given path, relative to the chart's root
+// directory. The path must not refer to a file outside of the chart.
+func (c *Chart) ReadFile(path string) ([]byte, error) {
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidChartFilePath, path)
+	}
+
+	chartPath, closer, err := c.pullExtracted()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = closer.Close()
+	}()
+
+	data, err := os.ReadFile(filepath.Join(chartPath, path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading chart file: %w", err)
+	}
+
+	return data, nil
+}
+
+// pullExtracted pulls and extracts the Helm chart using the provided
+// [TemplateOpts]. The returned [io.Closer] cleans up the extracted chart.
+func (c *Chart) pullExtracted() (string, io.Closer, error) {
+	chartName, repoURL, err := c.source()
+	if err != nil {
+		return "", nil, err
+	}
+	chartPath, closer, err := c.Client.PullWithCreds(chartName, repoURL,
+		c.TemplateOpts.TargetRevision, c.TemplateOpts.Credentials, c.keyring(), true, c.TemplateOpts.PassCredentials)
+	if err != nil {
+		return "", nil, fmt.Errorf("error pulling helm chart: %w", err)
+	}
+	return chartPath, closer, nil
+}
+
+// source returns the chart and RepoURL to pull the chart from. For git
+// repositories, the chart is the Path within the repository. If RepoURL is a
+// local repository (or `git+file://` URL) and RepoRoot is set, relative paths
+// are resolved from RepoRoot, and an error is returned if the repository or
+// chart is outside of RepoRoot.
+func (c *Chart) source() (string, string, error) {
+	chartName := c.TemplateOpts.ChartName
+	repoURL, checksum := splitChecksum(c.TemplateOpts.RepoURL)
+
+	gitPath, isGit := strings.CutPrefix(repoURL, gitRepoURLPrefix+"file://")
+	repoPath, isLocal := localRepoPath(repoURL)
+	if _, ok := gitRepoURL(repoURL); ok {
+		chartName = c.TemplateOpts.Path
+		repoPath, isLocal = gitPath, isGit
+	}
+	if !isLocal || c.TemplateOpts.RepoRoot == "" {
+		return chartName, c.TemplateOpts.RepoURL, nil
+	}
+
+	root, err := filepath.Abs(c.TemplateOpts.RepoRoot)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if !filepath.IsAbs(repoPath) {
+		repoPath = filepath.Join(root, repoPath)
+	}
+	paths := []string{repoPath}
+	if !isGit {
+		paths = append(paths, filepath.Join(repoPath, chartName))
+	}
+	for _, p := range paths {
+		if !withinDir(root, p) {
+			return "", "", fmt.Errorf("%w '%s': %s", ErrRepoURLOutsideRoot, root, c.TemplateOpts.RepoURL)
+		}
+	}
+	if isGit {
+		return chartName, joinChecksum(gitRepoURLPrefix+"file://"+repoPath, checksum), nil
+	}
+	return chartName, joinChecksum(repoPath, checksum), nil
+}
+
+// keyring returns the path of the [TemplateOpts.Keyring], resolving relative
+// paths from the RepoRoot.
+func (c *Chart) keyring() string {
+	keyring := c.TemplateOpts.Keyring
+	if keyring == "" || filepath.IsAbs(keyring) || c.TemplateOpts.RepoRoot == "" {
+		return keyring
+	}
+	return filepath.Join(c.TemplateOpts.RepoRoot, keyring)
+}
+
+// withinDir returns true if path is dir or is within dir, after resolving any
+// symbolic links in either path.
+func withinDir(dir, path string) bool {
+	dir = evalSymlinks(dir)
+	rel, err := filepath.Rel(dir, evalSymlinks(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// evalSymlinks returns the cleaned path after resolving any symbolic links.
+// If the path does not exist, symbolic links in its longest existing parent
+// are resolved.
+func evalSymlinks(path string) string {
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(evalSymlinks(parent), filepath.Base(path))
+}
+
+// CheckCompatibility checks whether the chart described by the given metadata
+// is deprecated, or incompatible with the given kubeVersion. An error is
+// returned for each issue found, joined with [errors.Join]. See
+// [argohelm.CheckCompatibility] for details.
+func CheckCompatibility(md *chart.Metadata, kubeVersion string) error {
+	return argohelm.CheckCompatibility(md, kubeVersion) //nolint:wrapcheck
 }
 
 // GetValuesJSONSchema pulls a Helm chart using the provided [TemplateOpts], and
@@ -122,10 +657,9 @@ func (c *Chart) template() ([]byte, error) {
 // more files from the chart. The [match] function can be used to match a subset
 // of the pulled files in the chart directory for JSON Schema generation.
 func (c *Chart) GetValuesJSONSchema(gen JSONSchemaGenerator, match func(string) bool) ([]byte, error) {
-	chartPath, closer, err := c.Client.PullWithCreds(c.TemplateOpts.ChartName, c.TemplateOpts.RepoURL,
-		c.TemplateOpts.TargetRevision, c.TemplateOpts.Credentials, true, c.TemplateOpts.PassCredentials)
+	chartPath, closer, err := c.pullExtracted()
 	if err != nil {
-		return nil, fmt.Errorf("error pulling helm chart: %w", err)
+		return nil, err
 	}
 	defer func() {
 		_ = closer.Close()
@@ -173,3 +707,54 @@ func (c *Chart) GetValuesJSONSchema(gen JSONSchemaGenerator, match func(string)
 
 	return jsonSchema, nil
 }
+
+// validateKubeVersion returns an error if the given kube version is not empty
+// and cannot be parsed by Helm.
+func validateKubeVersion(kubeVersion string) error {
+	if kubeVersion == "" {
+		return nil
+	}
+	if _, err := chartutil.ParseKubeVersion(kubeVersion); err != nil {
+		return fmt.Errorf("%w '%s': %w", ErrInvalidKubeVersion, kubeVersion, err)
+	}
+	return nil
+}
+
+// validateAPIVersions returns an error if any of the given API versions are not
+// in one of the formats accepted by Helm's `--api-versions`, i.e. "version",
+// "group/version", or "group/version/Kind".
+func validateAPIVersions(apiVersions []string) error {
+	for _, av := range apiVersions {
+		if err := validateAPIVersion(av); err != nil {
+			return fmt.Errorf("%w '%s': %w", ErrInvalidAPIVersion, av, err)
+		}
+	}
+	return nil
+}
+
+func validateAPIVersion(apiVersion string) error {
+	parts := strings.Split(apiVersion, "/")
+
+	var group, version, kind string
+	switch len(parts) {
+	case 1:
+		version = parts[0]
+	case 2:
+		group, version = parts[0], parts[1]
+	case 3:
+		group, version, kind = parts[0], parts[1], parts[2]
+	default:
+		return errors.New("expected format 'version', 'group/version', or 'group/version/Kind'")
+	}
+
+	if len(parts) > 1 && !apiGroupRegexp.MatchString(group) {
+		return fmt.Errorf("group '%s' is not a valid DNS subdomain", group)
+	}
+	if !apiVersionRegexp.MatchString(version) {
+		return fmt.Errorf("version '%s' must be of the form 'v1', 'v1beta1', etc", version)
+	}
+	if len(parts) > 2 && !apiKindRegexp.MatchString(kind) {
+		return fmt.Errorf("kind '%s' is not valid", kind)
+	}
+	return nil
+}
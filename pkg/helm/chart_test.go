@@ -1,13 +1,26 @@
 package helm_test
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
 	"github.com/MacroPower/kclipper/pkg/helm"
 	"github.com/MacroPower/kclipper/pkg/helmtest"
 	"github.com/MacroPower/kclipper/pkg/jsonschema"
@@ -101,38 +114,1286 @@ func TestHelmChart(t *testing.T) {
 	}
 }
 
-func BenchmarkHelmChart(b *testing.B) {
+func TestHelmChartKubeVersions(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		kubeVersion string
+		apiVersions []string
+		err         error
+	}{
+		"unset": {},
+		"valid": {
+			kubeVersion: "v1.30.2",
+			apiVersions: []string{"v1", "apps/v1", "monitoring.coreos.com/v1/ServiceMonitor"},
+		},
+		"invalid kube version": {
+			kubeVersion: "latest",
+			err:         helm.ErrInvalidKubeVersion,
+		},
+		"empty api version": {
+			apiVersions: []string{""},
+			err:         helm.ErrInvalidAPIVersion,
+		},
+		"invalid api version": {
+			apiVersions: []string{"apps/1"},
+			err:         helm.ErrInvalidAPIVersion,
+		},
+		"invalid api group": {
+			apiVersions: []string{"Apps/v1"},
+			err:         helm.ErrInvalidAPIVersion,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+				ChartName:   "simple-chart",
+				RepoURL:     "./testdata",
+				KubeVersion: tc.kubeVersion,
+				APIVersions: tc.apiVersions,
+			})
+
+			results, err := c.Template()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, results)
+		})
+	}
+}
+
+func TestHelmChartDependencies(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		chart string
+		kinds []string
+		err   error
+	}{
+		"local dependency": {
+			chart: "dependency-chart",
+			kinds: []string{"ConfigMap", "Deployment", "Service", "ServiceAccount"},
+		},
+		"stale lock": {
+			chart: "stale-lock-chart",
+			err:   helm.ErrDependencyLockDigest,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+			c := helm.NewChart(client, helm.TemplateOpts{
+				ChartName: tc.chart,
+				RepoURL:   "./testdata",
+			})
+
+			results, err := c.Template()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			kinds := []string{}
+			for _, r := range results {
+				kinds = append(kinds, r.GetKind())
+			}
+			require.ElementsMatch(t, tc.kinds, kinds)
+		})
+	}
+}
+
+func TestHelmChartDependenciesCache(t *testing.T) {
+	t.Parallel()
+
+	repoDir := t.TempDir()
+	for _, name := range []string{"dependency-chart", "simple-chart"} {
+		err := os.CopyFS(filepath.Join(repoDir, name), os.DirFS(filepath.Join("testdata", name)))
+		require.NoError(t, err)
+	}
+
+	paths := helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder())
+	client := helm.MustNewClient(paths, "test", "10M")
+	template := func() []string {
+		t.Helper()
+
+		results, err := helm.NewChart(client, helm.TemplateOpts{
+			ChartName: "dependency-chart",
+			RepoURL:   repoDir,
+		}).Template()
+		require.NoError(t, err)
+
+		kinds := []string{}
+		for _, r := range results {
+			kinds = append(kinds, r.GetKind())
+		}
+		return kinds
+	}
+
+	kinds := template()
+	require.ElementsMatch(t, []string{"ConfigMap", "Deployment", "Service", "ServiceAccount"}, kinds)
+	cached := len(paths.GetPaths())
+	require.Positive(t, cached)
+
+	// The built chart is reused by later renders.
+	require.Equal(t, kinds, template())
+	require.Len(t, paths.GetPaths(), cached)
+
+	// Changes to local dependencies are picked up.
+	err := os.WriteFile(filepath.Join(repoDir, "simple-chart", "templates", "extra.yaml"),
+		[]byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: extra\n"), 0o600)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"ConfigMap", "Deployment", "Secret", "Service", "ServiceAccount"}, template())
+}
+
+func TestHelmChartRelease(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		chart  string
+		values map[string]any
+		notes  bool
+		want   helm.ReleaseChart
+	}{
+		"simple": {
+			chart: "simple-chart",
+			values: map[string]any{
+				"replicaCount": 3,
+			},
+			notes: true,
+			want: helm.ReleaseChart{
+				Name:         "simple-chart",
+				Version:      "0.1.0",
+				AppVersion:   "1.16.0",
+				Dependencies: []helm.ReleaseChart{},
+			},
+		},
+		"dependency enabled": {
+			chart: "dependency-chart",
+			want: helm.ReleaseChart{
+				Name:    "dependency-chart",
+				Version: "0.1.0",
+				Dependencies: []helm.ReleaseChart{
+					{
+						Name:         "simple-chart",
+						Version:      "0.1.0",
+						AppVersion:   "1.16.0",
+						Dependencies: []helm.ReleaseChart{},
+					},
+				},
+			},
+		},
+		"dependency disabled": {
+			chart: "dependency-chart",
+			values: map[string]any{
+				"simple-chart": map[string]any{"enabled": false},
+			},
+			want: helm.ReleaseChart{
+				Name:         "dependency-chart",
+				Version:      "0.1.0",
+				Dependencies: []helm.ReleaseChart{},
+			},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+			c := helm.NewChart(client, helm.TemplateOpts{
+				ChartName:    tc.chart,
+				RepoURL:      "./testdata",
+				ValuesObject: tc.values,
+			})
+
+			rel, err := c.Release()
+			require.NoError(t, err)
+			require.NotEmpty(t, rel.Resources)
+			require.Equal(t, tc.want, rel.Chart)
+			require.Equal(t, tc.notes, rel.Notes != "")
+
+			// Values include both the chart defaults and the provided values.
+			require.NotEmpty(t, rel.Values)
+			for k, v := range tc.values {
+				if m, ok := v.(map[string]any); ok {
+					require.Subset(t, rel.Values[k], m)
+					continue
+				}
+				require.EqualValues(t, v, rel.Values[k])
+			}
+		})
+	}
+}
+
+func TestHelmChartPatches(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		patches []helm.Patch
+		check   func(t *testing.T, objs map[string]*unstructured.Unstructured)
+		err     error
+	}{
+		"strategic merge": {
+			patches: []helm.Patch{{
+				Patch: `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: simple-chart
+spec:
+  template:
+    spec:
+      containers:
+        - name: simple-chart
+          image: nginx:patched
+        - name: sidecar
+          image: busybox
+`,
+			}},
+			check: func(t *testing.T, objs map[string]*unstructured.Unstructured) {
+				t.Helper()
+
+				containers, _, err := unstructured.NestedSlice(objs["Deployment"].Object,
+					"spec", "template", "spec", "containers")
+				require.NoError(t, err)
+				require.Len(t, containers, 2)
+				images := []any{}
+				for _, c := range containers {
+					images = append(images, c.(map[string]any)["image"])
+				}
+				require.ElementsMatch(t, []any{"nginx:patched", "busybox"}, images)
+				// Other fields of the merged container are preserved.
+				for _, c := range containers {
+					if c.(map[string]any)["name"] == "simple-chart" {
+						require.NotEmpty(t, c.(map[string]any)["ports"])
+					}
+				}
+			},
+		},
+		"json patch with label selector": {
+			patches: []helm.Patch{{
+				Patch: `
+- op: add
+  path: /metadata/annotations
+  value:
+    example.com/patched: "true"
+`,
+				Target: &helm.PatchTarget{
+					Kind:          "Service.*",
+					LabelSelector: "app.kubernetes.io/name=simple-chart",
+				},
+			}},
+			check: func(t *testing.T, objs map[string]*unstructured.Unstructured) {
+				t.Helper()
+
+				for kind, obj := range objs {
+					_, patched := obj.GetAnnotations()["example.com/patched"]
+					require.Equal(t, kind == "Service" || kind == "ServiceAccount", patched, kind)
+				}
+			},
+		},
+		"delete": {
+			patches: []helm.Patch{{
+				Patch: `
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: simple-chart
+$patch: delete
+`,
+			}},
+			check: func(t *testing.T, objs map[string]*unstructured.Unstructured) {
+				t.Helper()
+
+				require.NotContains(t, objs, "ServiceAccount")
+				require.Contains(t, objs, "Service")
+			},
+		},
+		"json patch without target": {
+			patches: []helm.Patch{{
+				Patch: `[{"op": "remove", "path": "/spec"}]`,
+			}},
+			err: helm.ErrPatchTargetRequired,
+		},
+		"invalid": {
+			patches: []helm.Patch{{
+				Patch: "foo",
+			}},
+			err: helm.ErrInvalidPatch,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+				ChartName: "simple-chart",
+				RepoURL:   "./testdata",
+				Patches:   tc.patches,
+			})
+
+			results, err := c.Template()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			objs := map[string]*unstructured.Unstructured{}
+			for _, r := range results {
+				objs[r.GetKind()] = r
+			}
+			tc.check(t, objs)
+		})
+	}
+}
+
+func TestHelmChartShow(t *testing.T) {
+	t.Parallel()
+
 	c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
-		ChartName:      "podinfo",
-		TargetRevision: "6.7.1",
-		RepoURL:        "https://stefanprodan.github.io/podinfo",
+		ChartName: "simple-chart",
+		RepoURL:   "./testdata",
 	})
-	_, err := c.Template()
-	require.NoError(b, err)
 
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		for pb.Next() {
+	values, err := c.ShowValues()
+	require.NoError(t, err)
+	require.EqualValues(t, 1, values["replicaCount"])
+	require.Contains(t, values, "image")
+
+	md, err := c.GetChartMetadata()
+	require.NoError(t, err)
+	require.Equal(t, "simple-chart", md.Name)
+	require.Equal(t, "1.16.0", md.AppVersion)
+
+	readme, err := c.ShowReadme()
+	require.NoError(t, err)
+	require.Contains(t, readme, "# simple-chart")
+
+	data, err := c.ReadFile("templates/service.yaml")
+	require.NoError(t, err)
+	require.Contains(t, string(data), "kind: Service")
+
+	_, err = c.ReadFile("templates/missing.yaml")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	for _, p := range []string{"../dependency-chart/Chart.yaml", "/etc/passwd", ""} {
+		_, err = c.ReadFile(p)
+		require.ErrorIs(t, err, helm.ErrInvalidChartFilePath, p)
+	}
+
+	// Charts without a README return an empty string.
+	dc := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+		ChartName: "dependency-chart",
+		RepoURL:   "./testdata",
+	})
+	readme, err = dc.ShowReadme()
+	require.NoError(t, err)
+	require.Empty(t, readme)
+}
+
+func TestHelmChartChartCache(t *testing.T) {
+	t.Parallel()
+
+	cc := argohelm.NewChartCache(argohelm.DefaultChartCacheSize)
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+
+	// Rendering modifies the loaded chart (e.g. removing disabled
+	// dependencies), so cached charts must not be affected by earlier renders.
+	for _, enabled := range []bool{true, false, true} {
+		opts := helm.TemplateOpts{
+			ChartName: "dependency-chart",
+			RepoURL:   "./testdata",
+			ValuesObject: map[string]any{
+				"simple-chart": map[string]any{"enabled": enabled},
+			},
+		}
+
+		want, err := helm.NewChart(client, opts).Release()
+		require.NoError(t, err)
+
+		got, err := helm.NewChart(client, opts, helm.WithChartCache(cc)).Release()
+		require.NoError(t, err)
+		require.Equal(t, want.Resources, got.Resources)
+		require.Equal(t, want.Chart, got.Chart)
+		require.Equal(t, want.Values, got.Values)
+	}
+}
+
+func TestHelmChartLookup(t *testing.T) {
+	t.Parallel()
+
+	lookupObjects, err := helm.LoadLookupObjects("./testdata/lookup-objects")
+	require.NoError(t, err)
+	require.Len(t, lookupObjects, 2)
+
+	tcs := map[string]struct {
+		lookupObjects []map[string]any
+		want          string
+	}{
+		"no lookup objects": {
+			want: "generated",
+		},
+		"lookup objects": {
+			lookupObjects: lookupObjects,
+			want:          "existing",
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+				ChartName:     "lookup-chart",
+				RepoURL:       "./testdata",
+				Namespace:     "default",
+				LookupObjects: tc.lookupObjects,
+			})
+
+			results, err := c.Template()
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			password, _, err := unstructured.NestedString(results[0].Object, "data", "password")
+			require.NoError(t, err)
+			require.Equal(t, base64.StdEncoding.EncodeToString([]byte(tc.want)), password)
+		})
+	}
+}
+
+func TestHelmChartInjectNamespace(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		opts helm.TemplateOpts
+		want map[string]string
+	}{
+		"disabled": {
+			opts: helm.TemplateOpts{},
+			want: map[string]string{
+				"ConfigMap/namespace-chart":       "",
+				"ConfigMap/namespace-chart-other": "other",
+				"Widget/namespace-chart":          "",
+				"ClusterIssuer/namespace-chart":   "",
+			},
+		},
+		"enabled": {
+			opts: helm.TemplateOpts{InjectNamespace: true},
+			want: map[string]string{
+				"ConfigMap/namespace-chart":       "test",
+				"ConfigMap/namespace-chart-other": "other",
+				"Widget/namespace-chart":          "test",
+				"ClusterIssuer/namespace-chart":   "test",
+			},
+		},
+		"cluster scoped kinds": {
+			opts: helm.TemplateOpts{
+				InjectNamespace:    true,
+				ClusterScopedKinds: []string{"ClusterIssuer.cert-manager.io"},
+			},
+			want: map[string]string{
+				"ConfigMap/namespace-chart":       "test",
+				"ConfigMap/namespace-chart-other": "other",
+				"Widget/namespace-chart":          "test",
+				"ClusterIssuer/namespace-chart":   "",
+			},
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tc.opts
+			opts.ChartName = "namespace-chart"
+			opts.RepoURL = "./testdata"
+			opts.Namespace = "test"
+			c := helm.NewChart(helmtest.DefaultTestClient, opts)
+
+			results, err := c.Template()
+			require.NoError(t, err)
+
+			got := map[string]string{}
+			for _, obj := range results {
+				got[obj.GetKind()+"/"+obj.GetName()] = obj.GetNamespace()
+			}
+			for _, k := range []string{
+				"CustomResourceDefinition/widgets.example.com",
+				"CustomResourceDefinition/gadgets.example.com",
+				"Namespace/namespace-chart",
+				"ClusterRole/namespace-chart",
+				"Gadget/namespace-chart",
+			} {
+				require.Contains(t, got, k)
+				require.Empty(t, got[k], k)
+				delete(got, k)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestHelmChartNormalize(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		opts     helm.TemplateOpts
+		want     []string
+		wantCRDs []string
+		err      error
+		errMsg   string
+	}{
+		"empty documents": {
+			opts:   helm.TemplateOpts{},
+			errMsg: "Object 'Kind' is missing",
+		},
+		"drop empty": {
+			opts: helm.TemplateOpts{DropEmpty: true},
+			want: []string{"CustomResourceDefinition", "Deployment", "List", "Widget"},
+		},
+		"flatten lists": {
+			opts: helm.TemplateOpts{DropEmpty: true, FlattenLists: true},
+			want: []string{"CustomResourceDefinition", "Deployment", "Service", "ConfigMap", "Widget"},
+		},
+		"sort install order": {
+			opts: helm.TemplateOpts{DropEmpty: true, FlattenLists: true, SortInstallOrder: true},
+			want: []string{"ConfigMap", "CustomResourceDefinition", "Service", "Deployment", "Widget"},
+		},
+		"crds first": {
+			opts: helm.TemplateOpts{
+				DropEmpty:        true,
+				FlattenLists:     true,
+				SortInstallOrder: true,
+				CRDPlacement:     helm.CRDPlacementFirst,
+			},
+			want: []string{"CustomResourceDefinition", "ConfigMap", "Service", "Deployment", "Widget"},
+		},
+		"crds separate": {
+			opts: helm.TemplateOpts{
+				DropEmpty:        true,
+				FlattenLists:     true,
+				SortInstallOrder: true,
+				CRDPlacement:     helm.CRDPlacementSeparate,
+			},
+			want:     []string{"ConfigMap", "Service", "Deployment", "Widget"},
+			wantCRDs: []string{"CustomResourceDefinition"},
+		},
+		"invalid crd placement": {
+			opts: helm.TemplateOpts{DropEmpty: true, CRDPlacement: "Last"},
+			err:  helm.ErrInvalidCRDPlacement,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tc.opts
+			opts.ChartName = "normalize-chart"
+			opts.RepoURL = "./testdata"
+			c := helm.NewChart(helmtest.DefaultTestClient, opts)
+
+			rel, err := c.Release()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			if tc.errMsg != "" {
+				require.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, kinds(rel.Resources))
+			require.Equal(t, tc.wantCRDs, kinds(rel.CRDs))
+
+			objs, err := c.Template()
+			require.NoError(t, err)
+			require.Equal(t, append(kinds(rel.CRDs), tc.want...), kinds(objs))
+		})
+	}
+}
+
+func kinds(objs []*unstructured.Unstructured) []string {
+	if objs == nil {
+		return nil
+	}
+	s := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		s = append(s, obj.GetKind())
+	}
+	return s
+}
+
+func TestHelmChartValueFiles(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/values.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		user, _, _ := r.BasicAuth()
+		_, _ = fmt.Fprintf(w, "image:\n  repository: example/nginx\npodAnnotations:\n  user: %q\n", user)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+
+	tcs := map[string]struct {
+		opts   helm.TemplateOpts
+		check  func(t *testing.T, values map[string]any)
+		err    error
+		errMsg string
+	}{
+		"chart value file": {
+			opts: helm.TemplateOpts{
+				ValueFiles: []string{"values-production.yaml"},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.EqualValues(t, 3, values["replicaCount"])
+				require.Equal(t, "production", getNested(t, values, "image", "tag"))
+				require.Equal(t, "IfNotPresent", getNested(t, values, "image", "pullPolicy"))
+			},
+		},
+		"merged in order": {
+			opts: helm.TemplateOpts{
+				ValueFiles: []string{"values-production.yaml", "./testdata/values/local.yaml"},
+				ValuesObject: map[string]any{
+					"replicaCount": 5,
+				},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.EqualValues(t, 5, values["replicaCount"])
+				require.Equal(t, "local", getNested(t, values, "image", "tag"))
+				require.Equal(t, "Always", getNested(t, values, "image", "pullPolicy"))
+			},
+		},
+		"remote value file": {
+			opts: helm.TemplateOpts{
+				ValueFiles:  []string{srv.URL + "/values.yaml"},
+				Credentials: helm.Creds{Username: "user"},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.Equal(t, "example/nginx", getNested(t, values, "image", "repository"))
+				// Credentials are not passed to other hosts.
+				require.Equal(t, "", getNested(t, values, "podAnnotations", "user"))
+			},
+		},
+		"remote value file with credentials": {
+			opts: helm.TemplateOpts{
+				ValueFiles:      []string{srv.URL + "/values.yaml?creds"},
+				Credentials:     helm.Creds{Username: "user"},
+				PassCredentials: true,
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.Equal(t, "user", getNested(t, values, "podAnnotations", "user"))
+			},
+		},
+		"missing value file": {
+			opts: helm.TemplateOpts{
+				ValueFiles: []string{"values-missing.yaml"},
+			},
+			err: helm.ErrValueFileNotFound,
+		},
+		"missing remote value file": {
+			opts: helm.TemplateOpts{
+				ValueFiles: []string{srv.URL + "/missing.yaml"},
+			},
+			errMsg: "404 Not Found",
+		},
+		"ignore missing value files": {
+			opts: helm.TemplateOpts{
+				ValueFiles:              []string{"values-missing.yaml", "values-production.yaml"},
+				IgnoreMissingValueFiles: true,
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.EqualValues(t, 3, values["replicaCount"])
+			},
+		},
+		"local value file from repo root": {
+			opts: helm.TemplateOpts{
+				RepoURL:    "./",
+				RepoRoot:   "testdata",
+				ValueFiles: []string{"values-production.yaml", "values/local.yaml"},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.Equal(t, "local", getNested(t, values, "image", "tag"))
+			},
+		},
+		"local value file outside repo root": {
+			opts: helm.TemplateOpts{
+				RepoURL:    "./",
+				RepoRoot:   "testdata",
+				ValueFiles: []string{"../chart_test.go"},
+			},
+			err: helm.ErrLocalFileOutsideRoot,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tc.opts
+			opts.ChartName = "simple-chart"
+			if opts.RepoURL == "" {
+				opts.RepoURL = "./testdata"
+			}
+
+			rel, err := helm.NewChart(client, opts).Release()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			if tc.errMsg != "" {
+				require.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			tc.check(t, rel.Values)
+		})
+	}
+}
+
+func TestHelmChartValuesSchema(t *testing.T) {
+	t.Parallel()
+
+	tcs := map[string]struct {
+		values     map[string]any
+		skip       bool
+		violations []string
+	}{
+		"valid": {
+			values: map[string]any{"replicas": 3},
+		},
+		"invalid": {
+			values: map[string]any{
+				"image":     map[string]any{"tag": 1},
+				"replicas":  -1,
+				"sub-chart": map[string]any{"port": "http"},
+			},
+			violations: []string{"/image/tag", "/replicas", "/sub-chart/port"},
+		},
+		"disabled sub chart": {
+			values: map[string]any{
+				"sub-chart": map[string]any{"enabled": false, "port": "http"},
+			},
+		},
+		"not validated": {
+			values: map[string]any{"replicas": -1},
+			skip:   true,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+				ChartName:            "schema-chart",
+				RepoURL:              "./testdata",
+				ValuesObject:         tc.values,
+				SkipSchemaValidation: true,
+				ValidateValuesSchema: !tc.skip,
+			})
+
 			_, err := c.Template()
-			require.NoError(b, err)
+			if tc.violations == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, helm.ErrValuesSchema)
+
+			var schemaErr *helm.ValuesSchemaError
+			require.ErrorAs(t, err, &schemaErr)
+			pointers := []string{}
+			for _, v := range schemaErr.Violations {
+				require.NotEmpty(t, v.Message)
+				pointers = append(pointers, v.Pointer)
+			}
+			require.ElementsMatch(t, tc.violations, pointers)
+		})
+	}
+}
+
+func TestHelmChartValuesSchemaRemoteRef(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = fmt.Fprint(w, `{"type": "object", "properties": {"tag": {"type": "string"}}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	repoDir := t.TempDir()
+	chartDir := filepath.Join(repoDir, "remote-schema-chart")
+	require.NoError(t, os.MkdirAll(chartDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(chartDir, "Chart.yaml"),
+		[]byte("apiVersion: v2\nname: remote-schema-chart\nversion: 0.1.0\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(chartDir, "values.schema.json"),
+		[]byte(`{"properties": {"image": {"$ref": "`+srv.URL+`/image.json"}}}`), 0o600))
+
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+
+	for _, tag := range []any{"1.0", 1} {
+		c := helm.NewChart(client, helm.TemplateOpts{
+			ChartName:            "remote-schema-chart",
+			RepoURL:              repoDir,
+			ValuesObject:         map[string]any{"image": map[string]any{"tag": tag}},
+			SkipSchemaValidation: true,
+			ValidateValuesSchema: true,
+		})
+		_, err := c.Template()
+		if _, ok := tag.(string); ok {
+			require.NoError(t, err)
+		} else {
+			require.ErrorContains(t, err, "/image/tag: got number, want string")
+		}
+	}
+
+	// The remote schema is only pulled once, and then compiled schemas are
+	// reused for the same chart.
+	require.EqualValues(t, 1, requests.Load())
+}
+
+func TestHelmChartSetValues(t *testing.T) {
+	t.Parallel()
+
+	valuesObject := map[string]any{
+		"replicaCount": 2,
+		"image":        map[string]any{"tag": "values"},
+	}
+
+	tcs := map[string]struct {
+		opts  helm.TemplateOpts
+		check func(t *testing.T, values map[string]any)
+		err   bool
+	}{
+		"set": {
+			opts: helm.TemplateOpts{
+				Set: []string{"replicaCount=4", "image.tag=set", "podAnnotations.a\\.b=c", "imagePullSecrets[0].name=pull"},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.EqualValues(t, 4, values["replicaCount"])
+				require.Equal(t, "set", getNested(t, values, "image", "tag"))
+				require.Equal(t, "c", getNested(t, values, "podAnnotations", "a.b"))
+				require.Equal(t, []any{map[string]any{"name": "pull"}}, values["imagePullSecrets"])
+			},
+		},
+		"set precedence": {
+			opts: helm.TemplateOpts{
+				ValueFiles: []string{"values-production.yaml"},
+				Set:        []string{"image.tag=set", "replicaCount=4"},
+				SetString:  []string{"image.tag=1234"},
+				SetFile:    []string{"image.tag=./testdata/values/tag.txt"},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.EqualValues(t, 4, values["replicaCount"])
+				require.Equal(t, "from-file\n", getNested(t, values, "image", "tag"))
+			},
+		},
+		"set string": {
+			opts: helm.TemplateOpts{
+				SetString: []string{"image.tag=1234"},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.Equal(t, "1234", getNested(t, values, "image", "tag"))
+				require.EqualValues(t, 2, values["replicaCount"])
+			},
+		},
+		"invalid set": {
+			opts: helm.TemplateOpts{
+				Set: []string{"image.tag"},
+			},
+			err: true,
+		},
+		"missing set file": {
+			opts: helm.TemplateOpts{
+				SetFile: []string{"image.tag=./testdata/values/missing.txt"},
+			},
+			err: true,
+		},
+		"set file from repo root": {
+			opts: helm.TemplateOpts{
+				RepoURL:  "./",
+				RepoRoot: "testdata",
+				SetFile:  []string{"image.tag=values/tag.txt"},
+			},
+			check: func(t *testing.T, values map[string]any) {
+				t.Helper()
+				require.Equal(t, "from-file\n", getNested(t, values, "image", "tag"))
+			},
+		},
+		"set file outside repo root": {
+			opts: helm.TemplateOpts{
+				RepoURL:  "./",
+				RepoRoot: "testdata",
+				SetFile:  []string{"image.tag=../chart_test.go"},
+			},
+			err: true,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tc.opts
+			opts.ChartName = "simple-chart"
+			if opts.RepoURL == "" {
+				opts.RepoURL = "./testdata"
+			}
+			opts.ValuesObject = valuesObject
+
+			rel, err := helm.NewChart(helmtest.DefaultTestClient, opts).Release()
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tc.check(t, rel.Values)
+		})
+	}
+
+	// Overrides must not modify the ValuesObject.
+	require.Equal(t, map[string]any{"tag": "values"}, valuesObject["image"])
+}
+
+func getNested(t *testing.T, m map[string]any, fields ...string) string {
+	t.Helper()
+
+	v, _, err := unstructured.NestedString(m, fields...)
+	require.NoError(t, err)
+	return v
+}
+
+func TestHelmChartTemplateError(t *testing.T) {
+	t.Parallel()
+
+	c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+		ChartName:           "template-errors",
+		RepoURL:             "../argoutil/helm/testdata",
+		ValuesObject:        map[string]any{"fail": true},
+		ShowTemplateOnError: true,
+	})
+
+	_, err := c.Template()
+	require.Error(t, err)
+
+	tplErr, ok := argohelm.AsTemplateError(err)
+	require.True(t, ok, err.Error())
+	require.Equal(t, argohelm.TemplateErrorFail, tplErr.Kind)
+	require.Equal(t, "fail is set", tplErr.Message)
+	require.Contains(t, tplErr.Template, `fail "fail is set"`)
+}
+
+func TestHelmChartLocalRepo(t *testing.T) {
+	t.Parallel()
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	ch, err := loader.Load("testdata/simple-chart")
+	require.NoError(t, err)
+	archiveDir := filepath.Join(t.TempDir(), "charts")
+	require.NoError(t, os.MkdirAll(archiveDir, 0o755))
+	archivePath, err := chartutil.Save(ch, archiveDir)
+	require.NoError(t, err)
+
+	tcs := map[string]struct {
+		opts helm.TemplateOpts
+		err  error
+	}{
+		"RelativeToRoot": {
+			opts: helm.TemplateOpts{ChartName: "simple-chart", RepoURL: "testdata", RepoRoot: wd},
+		},
+		"FileURL": {
+			opts: helm.TemplateOpts{ChartName: "simple-chart", RepoURL: "file://./testdata", RepoRoot: wd},
+		},
+		"AbsoluteFileURL": {
+			opts: helm.TemplateOpts{ChartName: "simple-chart", RepoURL: "file://" + filepath.Join(wd, "testdata")},
+		},
+		"ArchiveByRevision": {
+			opts: helm.TemplateOpts{
+				ChartName: "simple-chart", TargetRevision: "0.1.0",
+				RepoURL: "./charts", RepoRoot: filepath.Dir(archiveDir),
+			},
+		},
+		"ArchiveByName": {
+			opts: helm.TemplateOpts{
+				ChartName: filepath.Base(archivePath),
+				RepoURL:   "./charts", RepoRoot: filepath.Dir(archiveDir),
+			},
+		},
+		"ArchiveRepoURL": {
+			opts: helm.TemplateOpts{
+				ChartName: "simple-chart",
+				RepoURL:   "./charts/" + filepath.Base(archivePath), RepoRoot: filepath.Dir(archiveDir),
+			},
+		},
+		"RepoOutsideRoot": {
+			opts: helm.TemplateOpts{ChartName: "simple-chart", RepoURL: "../", RepoRoot: filepath.Join(wd, "testdata")},
+			err:  helm.ErrRepoURLOutsideRoot,
+		},
+		"ChartOutsideRoot": {
+			opts: helm.TemplateOpts{ChartName: "../../testdata/simple-chart", RepoURL: "./", RepoRoot: filepath.Join(wd, "testdata")},
+			err:  helm.ErrRepoURLOutsideRoot,
+		},
+		"AbsoluteOutsideRoot": {
+			opts: helm.TemplateOpts{ChartName: "simple-chart", RepoURL: wd, RepoRoot: filepath.Dir(archiveDir)},
+			err:  helm.ErrRepoURLOutsideRoot,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := helm.NewChart(helmtest.DefaultTestClient, tc.opts)
+			results, err := c.Template()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, results)
+
+			md, err := c.GetChartMetadata()
+			require.NoError(t, err)
+			require.Equal(t, "simple-chart", md.Name)
+		})
+	}
+}
+
+func TestHelmChartArchiveURL(t *testing.T) {
+	t.Parallel()
+
+	ch, err := loader.Load("testdata/simple-chart")
+	require.NoError(t, err)
+	archiveDir := t.TempDir()
+	archivePath, err := chartutil.Save(ch, archiveDir)
+	require.NoError(t, err)
+	data, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	badChecksum := strings.Repeat("0", len(checksum))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
 		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+	creds := helm.Creds{Username: "user", Password: "pass"}
+
+	tcs := map[string]struct {
+		repoURL string
+		creds   helm.Creds
+		err     error
+		errMsg  string
+	}{
+		"URL":             {repoURL: srv.URL + "/simple-chart-0.1.0.tgz", creds: creds},
+		"URLChecksum":     {repoURL: srv.URL + "/checksum/simple-chart-0.1.0.tgz#sha256=" + checksum, creds: creds},
+		"URLBadChecksum":  {repoURL: srv.URL + "/bad/simple-chart-0.1.0.tgz#sha256=" + badChecksum, creds: creds, err: helm.ErrChecksumMismatch},
+		"URLNoCreds":      {repoURL: srv.URL + "/no-creds/simple-chart-0.1.0.tgz", errMsg: "401 Unauthorized"},
+		"InvalidChecksum": {repoURL: srv.URL + "/simple-chart-0.1.0.tgz#sha256=abc", err: helm.ErrInvalidChecksum},
+		"FileChecksum":    {repoURL: "file://" + archivePath + "#sha256=" + checksum},
+		"FileBadChecksum": {repoURL: "file://" + archivePath + "#sha256=" + badChecksum, err: helm.ErrChecksumMismatch},
+		"DirChecksum":     {repoURL: "./testdata#sha256=" + checksum, err: helm.ErrInvalidChecksum},
+		"RepoChecksum":    {repoURL: "https://example.com/charts#sha256=" + checksum, err: helm.ErrInvalidChecksum},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := helm.NewChart(client, helm.TemplateOpts{
+				ChartName:   "simple-chart",
+				RepoURL:     tc.repoURL,
+				Credentials: tc.creds,
+			})
+			results, err := c.Template()
+			if tc.errMsg != "" {
+				require.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, results)
+
+			md, err := c.GetChartMetadata()
+			require.NoError(t, err)
+			require.Equal(t, "simple-chart", md.Name)
+		})
+	}
+}
+
+func TestHelmChartArchiveURLCache(t *testing.T) {
+	t.Parallel()
+
+	ch, err := loader.Load("testdata/simple-chart")
+	require.NoError(t, err)
+	archivePath, err := chartutil.Save(ch, t.TempDir())
+	require.NoError(t, err)
+	data, err := os.ReadFile(archivePath)
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+	c := helm.NewChart(client, helm.TemplateOpts{
+		ChartName: "simple-chart",
+		RepoURL:   srv.URL + "/simple-chart-0.1.0.tgz",
+	})
+	for range 3 {
+		_, err := c.Template()
+		require.NoError(t, err)
+	}
+
+	// The archive is only downloaded once, and then read from the cache.
+	require.EqualValues(t, 1, requests.Load())
+
+	// Archives exceeding the client's maximum size are rejected.
+	smallClient := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "1Ki")
+	_, err = helm.NewChart(smallClient, c.TemplateOpts).Template()
+	require.ErrorContains(t, err, "exceeds the maximum size")
+}
+
+func TestHelmChartPostRendererExec(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	script := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o700))
+		return path
+	}
+	appendConfigMap := script("append.sh",
+		`cat; printf -- '---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n' "$1"`)
+	fail := script("fail.sh", `echo "bad manifest" >&2; exit 3`)
+	slow := script("slow.sh", `exec sleep 10`)
+
+	tcs := map[string]struct {
+		exec   *helm.PostRendererExec
+		err    error
+		errMsg string
+	}{
+		"Append": {
+			exec: &helm.PostRendererExec{Command: appendConfigMap, Args: []string{"post-rendered"}},
+		},
+		"Fail": {
+			exec:   &helm.PostRendererExec{Command: fail},
+			err:    helm.ErrPostRenderer,
+			errMsg: "bad manifest",
+		},
+		"Timeout": {
+			exec:   &helm.PostRendererExec{Command: slow, Timeout: 100 * time.Millisecond},
+			err:    helm.ErrPostRenderer,
+			errMsg: "timed out after 100ms",
+		},
+		"NotFound": {
+			exec: &helm.PostRendererExec{Command: filepath.Join(dir, "missing")},
+			err:  helm.ErrPostRenderer,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+				ChartName:        "simple-chart",
+				RepoURL:          "./testdata",
+				PostRendererExec: tc.exec,
+			})
+			results, err := c.Template()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				require.ErrorContains(t, err, tc.errMsg)
+				return
+			}
+			require.NoError(t, err)
+
+			names := map[string]string{}
+			for _, r := range results {
+				names[r.GetKind()] = r.GetName()
+			}
+			require.Equal(t, "post-rendered", names["ConfigMap"])
+			require.Contains(t, names, "Deployment")
+		})
+	}
+}
+
+func BenchmarkHelmChart(b *testing.B) {
+	benchmarkHelmChart(b, helm.TemplateOpts{
+		ChartName:      "podinfo",
+		TargetRevision: "6.7.1",
+		RepoURL:        "https://stefanprodan.github.io/podinfo",
 	})
 }
 
 func BenchmarkAppTemplateHelmChart(b *testing.B) {
-	c := helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+	benchmarkHelmChart(b, helm.TemplateOpts{
 		ChartName:      "app-template",
 		TargetRevision: "3.6.0",
 		RepoURL:        "https://bjw-s.github.io/helm-charts/",
 	})
-	_, err := c.Template()
+}
+
+func BenchmarkLocalHelmChart(b *testing.B) {
+	benchmarkHelmChart(b, helm.TemplateOpts{
+		ChartName: "simple-chart",
+		RepoURL:   "./testdata",
+	})
+}
+
+// benchmarkHelmChart benchmarks repeated renders of the same chart, without
+// caching, and with each of the in-memory chart cache and on-disk render cache.
+func benchmarkHelmChart(b *testing.B, opts helm.TemplateOpts) {
+	b.Helper()
+
+	renderCache, err := helm.NewRenderCache(b.TempDir(), "")
 	require.NoError(b, err)
 
-	b.ResetTimer()
-	b.RunParallel(func(pb *testing.PB) {
-		for pb.Next() {
+	bcs := map[string][]helm.ChartOpts{
+		"NoCache":     nil,
+		"ChartCache":  {helm.WithChartCache(argohelm.NewChartCache(argohelm.DefaultChartCacheSize))},
+		"RenderCache": {helm.WithRenderCache(renderCache)},
+	}
+	for name, chartOpts := range bcs {
+		b.Run(name, func(b *testing.B) {
+			c := helm.NewChart(helmtest.DefaultTestClient, opts, chartOpts...)
 			_, err := c.Template()
 			require.NoError(b, err)
-		}
-	})
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := c.Template()
+					require.NoError(b, err)
+				}
+			})
+		})
+	}
 }
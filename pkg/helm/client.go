@@ -2,22 +2,34 @@ package helm
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+	"github.com/MacroPower/kclipper/pkg/pathutil"
 )
 
-var DefaultClient = MustNewClient(
-	NewTempPaths(os.TempDir(), NewBase64PathEncoder()),
-	os.Getenv("ARGOCD_APP_PROJECT_NAME"),
-	"10M",
-)
+var DefaultClient = newDefaultClient()
+
+// newDefaultClient returns a [Client] for the Argo CD Project set in the
+// environment, using [SecureTempPaths] if [SecureCacheEnvVar] is "true". The
+// [SecureTempPaths] are created lazily, so an untrusted cache root is returned
+// as an error when pulling charts, rather than panicking on initialization.
+func newDefaultClient() *Client {
+	project := os.Getenv("ARGOCD_APP_PROJECT_NAME")
+	if strings.ToLower(os.Getenv(SecureCacheEnvVar)) == "true" {
+		return MustNewClient(NewLazySecureTempPaths(os.TempDir(), project, NewBase64PathEncoder()), project, "10M")
+	}
+	return MustNewClient(NewTempPaths(os.TempDir(), NewBase64PathEncoder()), project, "10M")
+}
 
 type PathCacher interface {
 	Add(key string, value string)
@@ -71,28 +83,45 @@ func MustNewClient(paths PathCacher, project, maxExtractSize string) *Client {
 // in .tar.gz format, and subsequent requests will try to use [PathCacher] rather
 // than re-pulling the chart.
 func (c *Client) Pull(chart, repoURL, targetRevision string, extract bool) (string, io.Closer, error) {
-	return c.PullWithCreds(chart, repoURL, targetRevision, Creds{}, extract, false)
+	return c.PullWithCreds(chart, repoURL, targetRevision, Creds{}, "", extract, false)
 }
 
+// PullWithCreds runs [Client.Pull] using the given credentials. For git
+// repositories (see [TemplateOpts.Path]), chart is the path of the chart
+// within the repository. repoURL can also be the HTTP(S) URL or local path of
+// a packaged chart, optionally followed by its expected SHA-256 digest (e.g.
+// "https://example.com/chart-1.0.0.tgz#sha256=<digest>"), in which case chart
+// and targetRevision are ignored. If keyring is set, the chart's provenance
+// file is verified using the keyring (see [TemplateOpts.Keyring]).
 func (c *Client) PullWithCreds(
-	chart, repoURL, targetRevision string, creds Creds, extract, passCredentials bool,
+	chart, repoURL, targetRevision string, creds Creds, keyring string, extract, passCredentials bool,
 ) (string, io.Closer, error) {
-	repoNetURL, err := url.Parse(repoURL)
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to parse repoURL '%s': %w", repoURL, err)
+	repoURL, checksum := splitChecksum(repoURL)
+	if checksum != "" {
+		if err := validateChecksum(checksum); err != nil {
+			return "", nil, err
+		}
 	}
 
-	isLocal := repoNetURL.Hostname() == ""
-	if isLocal {
-		chartDir, err := filepath.Abs(repoURL)
-		if err != nil {
-			return "", nil, fmt.Errorf("failed to get absolute path: %w", err)
-		}
-		chartPath := filepath.Join(chartDir, chart)
-		if !dirExists(chartPath) {
-			return "", nil, fmt.Errorf("chart directory does not exist: %s", chartPath)
+	if isArchiveURL(repoURL) {
+		return c.pullArchive(repoURL, checksum, creds, keyring, extract)
+	}
+	if repoPath, ok := localRepoPath(repoURL); ok {
+		return c.pullLocal(chart, repoPath, targetRevision, checksum, keyring, extract)
+	}
+	if checksum != "" {
+		return "", nil, fmt.Errorf("%w: checksums are only supported for packaged charts", ErrInvalidChecksum)
+	}
+	if gitURL, ok := gitRepoURL(repoURL); ok {
+		if keyring != "" {
+			return "", nil, fmt.Errorf("%w: git repositories are not supported", ErrProvenanceUnsupported)
 		}
-		return chartPath, io.NopCloser(bytes.NewReader(nil)), nil
+		return c.pullGit(chart, gitURL, targetRevision, creds, extract)
+	}
+
+	repoNetURL, err := url.Parse(repoURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse repoURL '%s': %w", repoURL, err)
 	}
 
 	enableOCI := repoNetURL.Scheme == ""
@@ -107,12 +136,12 @@ func (c *Client) PullWithCreds(
 	}
 
 	ahc := argohelm.NewClient(repoNetURL.String(), argoCreds, enableOCI, c.Proxy, c.NoProxy,
-		argohelm.WithChartPaths(c.Paths))
+		argohelm.WithChartPaths(c.Paths), argohelm.WithKeyring(keyring))
 
 	var chartPath string
 	if !extract {
 		closer := io.NopCloser(bytes.NewReader(nil))
-		chartPath, err = ahc.PullChart(chart, targetRevision, c.Project, passCredentials,
+		chartPath, err = ahc.PullChart(chart, targetRevision, c.cacheProject(creds), passCredentials,
 			c.MaxExtractSize.Value(), c.MaxExtractSize.IsZero())
 		if err != nil {
 			return "", closer, fmt.Errorf("error extracting helm chart: %w", err)
@@ -120,7 +149,7 @@ func (c *Client) PullWithCreds(
 		return chartPath, closer, nil
 	}
 
-	chartPath, closer, err := ahc.ExtractChart(chart, targetRevision, c.Project, passCredentials,
+	chartPath, closer, err := ahc.ExtractChart(chart, targetRevision, c.cacheProject(creds), passCredentials,
 		c.MaxExtractSize.Value(), c.MaxExtractSize.IsZero())
 	if err != nil {
 		return "", closer, fmt.Errorf("error extracting helm chart: %w", err)
@@ -128,6 +157,137 @@ func (c *Client) PullWithCreds(
 	return chartPath, closer, nil
 }
 
+// cacheProject returns the Project used in the cache keys of files pulled with
+// the given credentials. If any credentials are set, their digest is included,
+// so files pulled from private repositories are not shared with requests using
+// different credentials.
+func (c *Client) cacheProject(creds ...Creds) string {
+	h := sha256.New()
+	hasCreds := false
+	for _, cr := range creds {
+		if cr.Username == "" && cr.Password == "" && len(cr.CertData) == 0 && len(cr.KeyData) == 0 {
+			continue
+		}
+		hasCreds = true
+		for _, b := range [][]byte{[]byte(cr.Username), []byte(cr.Password), cr.CertData, cr.KeyData} {
+			_, _ = fmt.Fprintf(h, "%d:", len(b))
+			_, _ = h.Write(b)
+		}
+	}
+	if !hasCreds {
+		return c.Project
+	}
+	return c.Project + "#" + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// sealCachedPath seals a file written to a path returned by the client's
+// [PathCacher], if it implements [pathutil.Sealer].
+func (c *Client) sealCachedPath(path string) error {
+	if sealer, ok := c.Paths.(pathutil.Sealer); ok {
+		if err := sealer.Seal(path); err != nil {
+			return fmt.Errorf("failed to seal chart cache file: %w", err)
+		}
+	}
+	return nil
+}
+
+// pullLocal returns the path to a chart in a local repository. The repository
+// is either a directory containing chart directories or packaged charts (named
+// either chart, or "<chart>-<targetRevision>.tgz"), or a packaged chart. If
+// checksum is set, the chart must be packaged, and its SHA-256 digest must
+// match checksum. If keyring is set, the chart must be packaged, and have a
+// provenance file signed by a key in the keyring.
+func (c *Client) pullLocal(
+	chart, repoPath, targetRevision, checksum, keyring string, extract bool,
+) (string, io.Closer, error) {
+	repoPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	nopCloser := io.NopCloser(bytes.NewReader(nil))
+	chartPath := filepath.Join(repoPath, chart)
+
+	var archivePath string
+	switch {
+	case isChartArchive(repoPath) && fileExists(repoPath):
+		archivePath = repoPath
+	case dirExists(chartPath):
+		if checksum != "" {
+			return "", nil, fmt.Errorf("%w: checksums are only supported for packaged charts", ErrInvalidChecksum)
+		}
+		if keyring != "" {
+			return "", nil, fmt.Errorf("%w: chart directories are not supported", ErrProvenanceUnsupported)
+		}
+		return chartPath, nopCloser, nil
+	case isChartArchive(chart) && fileExists(chartPath):
+		archivePath = chartPath
+	case targetRevision != "" && fileExists(filepath.Join(repoPath, chart+"-"+targetRevision+".tgz")):
+		archivePath = filepath.Join(repoPath, chart+"-"+targetRevision+".tgz")
+	default:
+		return "", nil, fmt.Errorf("chart directory does not exist: %s", chartPath)
+	}
+
+	if err := verifyFileChecksum(archivePath, checksum); err != nil {
+		return "", nil, err
+	}
+	if keyring != "" {
+		if err := verifyProvenance(archivePath, keyring); err != nil {
+			return "", nil, err
+		}
+	}
+	return c.openArchive(archivePath, extract)
+}
+
+// openArchive returns the path to the packaged chart at archivePath, or if
+// extract is set, extracts it and returns the path to the extracted chart.
+func (c *Client) openArchive(archivePath string, extract bool) (string, io.Closer, error) {
+	if !extract {
+		return archivePath, io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	extractedPath, closer, err := argohelm.ExtractChartArchive(archivePath,
+		c.MaxExtractSize.Value(), c.MaxExtractSize.IsZero())
+	if err != nil {
+		return "", nil, fmt.Errorf("error extracting helm chart: %w", err)
+	}
+	return extractedPath, closer, nil
+}
+
+// localRepoPath returns the path of a local repository, and true if repoURL is
+// a local path or `file://` URL. Otherwise, repoURL is an HTTP(S) repository
+// or an OCI registry. OCI registries are given without a scheme, so paths
+// whose first element looks like a host (e.g. "ghcr.io/org/charts" or
+// "localhost:5000/charts") are OCI registries. Local paths which could be
+// mistaken for hosts must be prefixed with "./".
+func localRepoPath(repoURL string) (string, bool) {
+	if p, ok := strings.CutPrefix(repoURL, "file://"); ok {
+		return p, true
+	}
+	if u, err := url.Parse(repoURL); err == nil && u.Scheme != "" && u.Host != "" {
+		return "", false
+	}
+	if filepath.IsAbs(repoURL) || strings.HasPrefix(repoURL, ".") {
+		return repoURL, true
+	}
+	host, _, _ := strings.Cut(repoURL, "/")
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return "", false
+	}
+	return repoURL, true
+}
+
+func isChartArchive(path string) bool {
+	return strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz")
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	return true
+}
+
 func dirExists(path string) bool {
 	fi, err := os.Lstat(path)
 	if err != nil || !fi.IsDir() {
@@ -0,0 +1,346 @@
+package helm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+	"github.com/MacroPower/kclipper/pkg/argoutil/sync"
+)
+
+var (
+	ErrMissingDependency    = errors.New("missing chart dependency")
+	ErrDependencyLockDigest = errors.New("dependency lock file Chart.lock is out of sync with the dependencies in Chart.yaml")
+	ErrDependencyVersion    = errors.New("dependency version does not match Chart.lock")
+
+	dependencyLock = sync.NewKeyLock()
+)
+
+// DependencyOpts configures how chart dependencies are resolved by
+// [Client.BuildDependencies].
+type DependencyOpts struct {
+	// RepoURL is the repository URL of the parent chart. Credentials are only
+	// passed to dependencies hosted on the same host as the parent chart,
+	// unless PassCredentials is set.
+	RepoURL         string
+	Credentials     Creds
+	PassCredentials bool
+	// Repositories are used to resolve dependencies referencing a repository
+	// by name (e.g. "@name" or "alias:name"), and to provide credentials for
+	// dependencies referencing a repository by URL.
+	Repositories []argohelm.HelmRepository
+}
+
+// BuildDependencies loads the chart at chartPath and pulls each dependency
+// that is declared in the chart's Chart.yaml but missing from its charts/
+// directory, similar to `helm dependency build`. If the chart has a
+// Chart.lock, it must be in sync with Chart.yaml, and the locked versions are
+// used. Dependencies are pulled using the same cache and credential handling
+// as any other chart.
+//
+// The path to a chart archive containing all dependencies is returned. Calling
+// Close() on the returned io.Closer will clean up the archive if needed. The
+// built archive is stored in the client's [PathCacher], keyed by the digest of
+// the chart (and of any local `file://` dependencies), so dependencies are
+// only built once.
+func (c *Client) BuildDependencies(chartPath string, opts DependencyOpts) (string, io.Closer, error) {
+	nopCloser := io.NopCloser(bytes.NewReader(nil))
+
+	ch, err := loader.Load(chartPath)
+	if err != nil {
+		return "", nopCloser, fmt.Errorf("failed to load chart: %w", err)
+	}
+	missing := missingDependencies(ch)
+	if len(missing) == 0 {
+		return chartPath, nopCloser, nil
+	}
+
+	lockedVersions, err := getLockedVersions(ch)
+	if err != nil {
+		return "", nopCloser, err
+	}
+
+	chartDir := ""
+	if dirExists(chartPath) {
+		chartDir = chartPath
+	}
+	digest, err := dependencyBuildDigest(chartPath, chartDir, missing, opts)
+	if err != nil {
+		return "", nopCloser, err
+	}
+	key := map[string]string{
+		"url":     opts.RepoURL,
+		"chart":   ch.Name(),
+		"version": fmt.Sprintf("%s_deps_%s", ch.Metadata.Version, digest),
+		"project": c.cacheProject(dependencyCreds(opts)...),
+	}
+	if chartDir != "" {
+		// Local charts are identified by their digest, and their paths may be
+		// too long to use in cache file names.
+		delete(key, "url")
+	}
+	keyData, err := json.Marshal(key)
+	if err != nil {
+		return "", nopCloser, fmt.Errorf("failed to marshal cache key data: %w", err)
+	}
+	builtPath, err := c.Paths.GetPath(string(keyData))
+	if err != nil {
+		return "", nopCloser, fmt.Errorf("failed to get chart cache path: %w", err)
+	}
+
+	dependencyLock.Lock(builtPath)
+	defer dependencyLock.Unlock(builtPath)
+
+	if _, err := os.Stat(builtPath); err == nil {
+		return builtPath, nopCloser, nil
+	}
+
+	if err := c.addDependencies(ch, missing, lockedVersions, chartDir, opts); err != nil {
+		return "", nopCloser, err
+	}
+	tmpDir, err := os.MkdirTemp("", "helm-deps")
+	if err != nil {
+		return "", nopCloser, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	savedPath, err := chartutil.Save(ch, tmpDir)
+	if err != nil {
+		return "", nopCloser, fmt.Errorf("failed to save chart with dependencies: %w", err)
+	}
+	if err := os.Rename(savedPath, builtPath); err != nil {
+		return "", nopCloser, fmt.Errorf("failed to rename file from %s to %s: %w", savedPath, builtPath, err)
+	}
+	if err := c.sealCachedPath(builtPath); err != nil {
+		return "", nopCloser, err
+	}
+
+	return builtPath, nopCloser, nil
+}
+
+// dependencyBuildDigest returns a digest identifying the chart at chartPath
+// with the given missing dependencies. For chart directories, the contents of
+// `file://` dependencies are included, since they can change independently of
+// the chart.
+func dependencyBuildDigest(chartPath, chartDir string, missing []*chart.Dependency, opts DependencyOpts) (string, error) {
+	digest, err := argohelm.ChartDigest(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chart digest: %w", err)
+	}
+	if chartDir == "" {
+		return digest, nil
+	}
+
+	// Truncated, since the digest is part of the cache file name.
+	h := sha256.New()
+	h.Write([]byte(digest))
+	for _, dep := range missing {
+		if !strings.HasPrefix(dep.Repository, "file://") {
+			continue
+		}
+		repoPath, chartName, _, err := resolveDependencyRepo(dep, chartDir, opts)
+		if err != nil {
+			return "", err
+		}
+		depPath := filepath.Join(repoPath, chartName)
+		if !dirExists(depPath) {
+			// Missing dependencies fail to pull, and are never cached.
+			continue
+		}
+		depDigest, err := argohelm.ChartDigest(depPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to get digest of dependency '%s': %w", dep.Name, err)
+		}
+		_, _ = fmt.Fprintf(h, "\x00%s\x00%s", dep.Name, depDigest)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
+
+// addDependencies pulls each of the given dependencies and adds them to the
+// chart. The chartDir is used to resolve `file://` dependencies, and must be
+// empty if the chart is not a local directory.
+func (c *Client) addDependencies(
+	ch *chart.Chart, deps []*chart.Dependency, lockedVersions map[string]string, chartDir string, opts DependencyOpts,
+) error {
+	for _, dep := range deps {
+		version := dep.Version
+		lockedVersion, locked := lockedVersions[dep.Name]
+		if locked {
+			version = lockedVersion
+		}
+
+		repoURL, chartName, creds, err := resolveDependencyRepo(dep, chartDir, opts)
+		if err != nil {
+			return err
+		}
+
+		depPath, closer, err := c.PullWithCreds(chartName, repoURL, version, creds, "", false, opts.PassCredentials)
+		if err != nil {
+			return fmt.Errorf("failed to pull dependency '%s': %w", dep.Name, err)
+		}
+		depChart, err := loader.Load(depPath)
+		_ = closer.Close()
+		if err != nil {
+			return fmt.Errorf("failed to load dependency '%s': %w", dep.Name, err)
+		}
+
+		if locked && depChart.Metadata.Version != lockedVersion {
+			return fmt.Errorf("%w: %s locked to %s, got %s",
+				ErrDependencyVersion, dep.Name, lockedVersion, depChart.Metadata.Version)
+		}
+
+		ch.AddDependency(depChart)
+	}
+
+	return nil
+}
+
+// missingDependencies returns the dependencies declared in the chart's
+// Chart.yaml which are not present in the chart's charts/ directory. Aliased
+// dependencies sharing the same chart are only returned once.
+func missingDependencies(ch *chart.Chart) []*chart.Dependency {
+	present := map[string]bool{}
+	for _, d := range ch.Dependencies() {
+		present[d.Name()] = true
+	}
+
+	missing := []*chart.Dependency{}
+	for _, dep := range ch.Metadata.Dependencies {
+		if dep == nil || present[dep.Name] {
+			continue
+		}
+		present[dep.Name] = true
+		missing = append(missing, dep)
+	}
+
+	return missing
+}
+
+// getLockedVersions returns the dependency versions pinned by the chart's
+// Chart.lock, keyed by dependency name. Returns an error if the lock's digest
+// does not match the dependencies declared in Chart.yaml.
+func getLockedVersions(ch *chart.Chart) (map[string]string, error) {
+	if ch.Lock == nil {
+		return map[string]string{}, nil
+	}
+
+	digest, err := hashReq(ch.Metadata.Dependencies, ch.Lock.Dependencies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dependency digest: %w", err)
+	}
+	if digest != ch.Lock.Digest {
+		return nil, fmt.Errorf("%w: got %s, expected %s", ErrDependencyLockDigest, digest, ch.Lock.Digest)
+	}
+
+	versions := map[string]string{}
+	for _, dep := range ch.Lock.Dependencies {
+		versions[dep.Name] = dep.Version
+	}
+
+	return versions, nil
+}
+
+// hashReq returns the digest of the given dependencies and locked
+// dependencies, in the same way as Helm's internal resolver.
+func hashReq(req, lock []*chart.Dependency) (string, error) {
+	data, err := json.Marshal([2][]*chart.Dependency{req, lock})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal dependencies: %w", err)
+	}
+	s, err := provenance.Digest(bytes.NewBuffer(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to digest dependencies: %w", err)
+	}
+	return "sha256:" + s, nil
+}
+
+// dependencyCreds returns all credentials which may be used to pull
+// dependencies.
+func dependencyCreds(opts DependencyOpts) []Creds {
+	creds := []Creds{opts.Credentials}
+	for _, r := range opts.Repositories {
+		creds = append(creds, credsFromArgo(r.Creds))
+	}
+	return creds
+}
+
+// resolveDependencyRepo returns the repository URL, chart name and credentials
+// to use when pulling the given dependency.
+func resolveDependencyRepo(dep *chart.Dependency, chartDir string, opts DependencyOpts) (string, string, Creds, error) {
+	switch {
+	case dep.Repository == "":
+		return "", "", Creds{}, fmt.Errorf("%w: '%s' is not in the charts directory and has no repository",
+			ErrMissingDependency, dep.Name)
+
+	case strings.HasPrefix(dep.Repository, "file://"):
+		if chartDir == "" {
+			return "", "", Creds{}, fmt.Errorf("%w: '%s' uses a file:// repository, which is only supported for local charts",
+				ErrMissingDependency, dep.Name)
+		}
+		depPath := strings.TrimPrefix(dep.Repository, "file://")
+		if !filepath.IsAbs(depPath) {
+			depPath = filepath.Join(chartDir, depPath)
+		}
+		return filepath.Dir(depPath), filepath.Base(depPath), Creds{}, nil
+
+	case strings.HasPrefix(dep.Repository, "@"), strings.HasPrefix(dep.Repository, "alias:"):
+		name := strings.TrimPrefix(strings.TrimPrefix(dep.Repository, "@"), "alias:")
+		for _, r := range opts.Repositories {
+			if r.Name == name {
+				return strings.TrimPrefix(r.Repo, "oci://"), dep.Name, credsFromArgo(r.Creds), nil
+			}
+		}
+		return "", "", Creds{}, fmt.Errorf("%w: '%s' uses repository '%s', which is not configured",
+			ErrMissingDependency, dep.Name, name)
+	}
+
+	repoURL := strings.TrimPrefix(dep.Repository, "oci://")
+	for _, r := range opts.Repositories {
+		if strings.TrimSuffix(strings.TrimPrefix(r.Repo, "oci://"), "/") == strings.TrimSuffix(repoURL, "/") {
+			return repoURL, dep.Name, credsFromArgo(r.Creds), nil
+		}
+	}
+	if opts.PassCredentials || sameHost(dep.Repository, opts.RepoURL) {
+		return repoURL, dep.Name, opts.Credentials, nil
+	}
+
+	return repoURL, dep.Name, Creds{}, nil
+}
+
+func sameHost(a, b string) bool {
+	aURL, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	bURL, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return aURL.Host != "" && aURL.Host == bURL.Host
+}
+
+func credsFromArgo(creds argohelm.Creds) Creds {
+	return Creds{
+		Username:           creds.Username,
+		Password:           creds.Password,
+		CAPath:             creds.CAPath,
+		CertData:           creds.CertData,
+		KeyData:            creds.KeyData,
+		InsecureSkipVerify: creds.InsecureSkipVerify,
+	}
+}
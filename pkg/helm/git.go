@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/MacroPower/kclipper/pkg/argoutil/sync"
+)
+
+// gitRepoURLPrefix is the prefix of git repository URLs, e.g.
+// "git+https://example.com/org/repo.git" or "git+file:///path/to/repo".
+const gitRepoURLPrefix = "git+"
+
+var (
+	ErrGitRevisionNotFound = errors.New("git revision not found")
+	ErrInvalidGitChartPath = errors.New("chart path must be relative to and within the git repository")
+
+	gitChartLock = sync.NewKeyLock()
+)
+
+// gitRepoURL returns the URL of a git repository without its "git+" prefix,
+// and true if repoURL is a git repository URL.
+func gitRepoURL(repoURL string) (string, bool) {
+	return strings.CutPrefix(repoURL, gitRepoURLPrefix)
+}
+
+// gitOptions holds the options used to connect to a git repository.
+type gitOptions struct {
+	auth            transport.AuthMethod
+	caBundle        []byte
+	insecureSkipTLS bool
+}
+
+func newGitOptions(creds Creds) (*gitOptions, error) {
+	opts := &gitOptions{insecureSkipTLS: creds.InsecureSkipVerify}
+	if creds.Username != "" || creds.Password != "" {
+		opts.auth = &githttp.BasicAuth{Username: creds.Username, Password: creds.Password}
+	}
+	if creds.CAPath != "" {
+		caBundle, err := os.ReadFile(creds.CAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		opts.caBundle = caBundle
+	}
+	return opts, nil
+}
+
+// pullGit packages the chart at chartPath in the git repository at repoURL,
+// checked out at targetRevision (a branch, tag or commit SHA, defaulting to
+// the remote's HEAD). Packaged charts are stored in the injected [PathCacher]
+// keyed by the resolved commit SHA, so each commit is only cloned once.
+func (c *Client) pullGit(chartPath, repoURL, targetRevision string, creds Creds, extract bool) (string, io.Closer, error) {
+	opts, err := newGitOptions(creds)
+	if err != nil {
+		return "", nil, err
+	}
+	hash, err := resolveGitRevision(repoURL, targetRevision, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	keyData, err := json.Marshal(map[string]string{
+		"url":     gitRepoURLPrefix + repoURL,
+		"chart":   chartPath,
+		"version": hash.String(),
+		"project": c.cacheProject(creds),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal cache key data: %w", err)
+	}
+	cachedPath, err := c.Paths.GetPath(string(keyData))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get git chart cache path: %w", err)
+	}
+
+	gitChartLock.Lock(cachedPath)
+	defer gitChartLock.Unlock(cachedPath)
+
+	if !fileExists(cachedPath) {
+		if err := packageGitChart(repoURL, hash, chartPath, cachedPath, opts); err != nil {
+			return "", nil, err
+		}
+		if err := c.sealCachedPath(cachedPath); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return c.openArchive(cachedPath, extract)
+}
+
+// resolveGitRevision returns the commit SHA of the given revision in the git
+// repository at repoURL. Commit SHAs are returned as-is. Otherwise, revision
+// is the name of a branch or tag, or an empty string for the remote's HEAD.
+func resolveGitRevision(repoURL, revision string, opts *gitOptions) (plumbing.Hash, error) {
+	if plumbing.IsHash(revision) {
+		return plumbing.NewHash(revision), nil
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repoURL},
+	})
+	refs, err := remote.List(&git.ListOptions{
+		Auth:            opts.auth,
+		CABundle:        opts.caBundle,
+		InsecureSkipTLS: opts.insecureSkipTLS,
+		PeelingOption:   git.AppendPeeled,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to list references of '%s': %w", repoURL, err)
+	}
+
+	refsByName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, ref := range refs {
+		refsByName[ref.Name()] = ref
+	}
+
+	names := []plumbing.ReferenceName{plumbing.HEAD}
+	if revision != "" {
+		names = []plumbing.ReferenceName{
+			plumbing.ReferenceName(revision),
+			plumbing.NewBranchReferenceName(revision),
+			plumbing.NewTagReferenceName(revision),
+		}
+	}
+	for _, name := range names {
+		ref, ok := refsByName[name]
+		if !ok {
+			continue
+		}
+		// Resolve symbolic references such as HEAD.
+		for ref.Type() == plumbing.SymbolicReference {
+			if ref, ok = refsByName[ref.Target()]; !ok {
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		// Annotated tags are peeled to the commit they point to.
+		if peeled, ok := refsByName[ref.Name()+"^{}"]; ok {
+			return peeled.Hash(), nil
+		}
+		return ref.Hash(), nil
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("%w: '%s' in '%s'", ErrGitRevisionNotFound, revision, repoURL)
+}
+
+// packageGitChart clones the git repository at repoURL, checks out the given
+// commit, and packages the chart at chartPath to archivePath.
+func packageGitChart(repoURL string, hash plumbing.Hash, chartPath, archivePath string, opts *gitOptions) error {
+	cloneDir, err := os.MkdirTemp("", "helm-git")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(cloneDir) }()
+
+	repo, err := git.PlainClone(cloneDir, false, &git.CloneOptions{
+		URL:             repoURL,
+		Auth:            opts.auth,
+		CABundle:        opts.caBundle,
+		InsecureSkipTLS: opts.insecureSkipTLS,
+		NoCheckout:      true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clone '%s': %w", repoURL, err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree of '%s': %w", repoURL, err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return fmt.Errorf("failed to checkout '%s' in '%s': %w", hash, repoURL, err)
+	}
+
+	chartDir := filepath.Join(cloneDir, chartPath)
+	if !withinDir(cloneDir, chartDir) {
+		return fmt.Errorf("%w: %s", ErrInvalidGitChartPath, chartPath)
+	}
+	ch, err := loader.LoadDir(chartDir)
+	if err != nil {
+		return fmt.Errorf("failed to load chart '%s' from '%s': %w", chartPath, repoURL, err)
+	}
+
+	packageDir, err := os.MkdirTemp("", "helm-git-package")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(packageDir) }()
+
+	packagePath, err := chartutil.Save(ch, packageDir)
+	if err != nil {
+		return fmt.Errorf("failed to package chart '%s' from '%s': %w", chartPath, repoURL, err)
+	}
+	if err := os.Rename(packagePath, archivePath); err != nil {
+		return fmt.Errorf("failed to rename file from %s to %s: %w", packagePath, archivePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package helm_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/require"
+
+	"github.com/MacroPower/kclipper/pkg/helm"
+)
+
+func TestHelmChartGitRepo(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	bareDir := filepath.Join(root, "repo.git")
+	first, second := newGitChartRepo(t, bareDir)
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+
+	tcs := map[string]struct {
+		opts       helm.TemplateOpts
+		appVersion string
+		err        error
+	}{
+		"HEAD": {
+			opts:       helm.TemplateOpts{RepoURL: "git+file://" + bareDir},
+			appVersion: "2.0.0",
+		},
+		"Branch": {
+			opts:       helm.TemplateOpts{RepoURL: "git+file://" + bareDir, TargetRevision: "main"},
+			appVersion: "2.0.0",
+		},
+		"AnnotatedTag": {
+			opts:       helm.TemplateOpts{RepoURL: "git+file://" + bareDir, TargetRevision: "v1"},
+			appVersion: "1.16.0",
+		},
+		"CommitSHA": {
+			opts:       helm.TemplateOpts{RepoURL: "git+file://" + bareDir, TargetRevision: first},
+			appVersion: "1.16.0",
+		},
+		"RelativeToRoot": {
+			opts:       helm.TemplateOpts{RepoURL: "git+file://./repo.git", TargetRevision: second, RepoRoot: root},
+			appVersion: "2.0.0",
+		},
+		"MissingRevision": {
+			opts: helm.TemplateOpts{RepoURL: "git+file://" + bareDir, TargetRevision: "missing"},
+			err:  helm.ErrGitRevisionNotFound,
+		},
+		"PathOutsideRepo": {
+			opts: helm.TemplateOpts{RepoURL: "git+file://" + bareDir, Path: "../"},
+			err:  helm.ErrInvalidGitChartPath,
+		},
+		"RepoOutsideRoot": {
+			opts: helm.TemplateOpts{RepoURL: "git+file://../repo.git", RepoRoot: filepath.Join(root, "sub")},
+			err:  helm.ErrRepoURLOutsideRoot,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := tc.opts
+			opts.ChartName = "simple-chart"
+			if opts.Path == "" {
+				opts.Path = "charts/simple-chart"
+			}
+			c := helm.NewChart(client, opts)
+			results, err := c.Template()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, results)
+
+			md, err := c.GetChartMetadata()
+			require.NoError(t, err)
+			require.Equal(t, "simple-chart", md.Name)
+			require.Equal(t, tc.appVersion, md.AppVersion)
+		})
+	}
+}
+
+// newGitChartRepo creates a bare git repository at bareDir containing
+// testdata/simple-chart at "charts/simple-chart". The first commit is tagged
+// "v1", and the second commit on "main" changes the chart's appVersion to
+// "2.0.0". The SHAs of both commits are returned.
+func newGitChartRepo(t *testing.T, bareDir string) (string, string) {
+	t.Helper()
+
+	workDir := t.TempDir()
+	repo, err := git.PlainInitWithOptions(workDir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+
+	chartDir := filepath.Join(workDir, "charts", "simple-chart")
+	require.NoError(t, os.CopyFS(chartDir, os.DirFS("testdata/simple-chart")))
+
+	sig := &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(0, 0)}
+	commit := func(msg string) plumbing.Hash {
+		t.Helper()
+
+		_, err := wt.Add(".")
+		require.NoError(t, err)
+		hash, err := wt.Commit(msg, &git.CommitOptions{Author: sig})
+		require.NoError(t, err)
+		return hash
+	}
+
+	first := commit("Add simple-chart")
+	_, err = repo.CreateTag("v1", first, &git.CreateTagOptions{Tagger: sig, Message: "v1"})
+	require.NoError(t, err)
+
+	chartYAML := filepath.Join(chartDir, "Chart.yaml")
+	data, err := os.ReadFile(chartYAML)
+	require.NoError(t, err)
+	data = bytes.Replace(data, []byte(`appVersion: "1.16.0"`), []byte(`appVersion: "2.0.0"`), 1)
+	require.NoError(t, os.WriteFile(chartYAML, data, 0o644))
+	second := commit("Bump appVersion")
+
+	_, err = git.PlainClone(bareDir, true, &git.CloneOptions{URL: workDir})
+	require.NoError(t, err)
+
+	return first.String(), second.String()
+}
@@ -0,0 +1,52 @@
+package helm
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MacroPower/kclipper/pkg/argoutil/kube"
+)
+
+// LookupDirEnvVar is the environment variable containing the default
+// directory of objects returned by Helm's `lookup` function when rendering
+// charts with the helm plugin. See [LoadLookupObjects].
+const LookupDirEnvVar = "KCLX_HELM_LOOKUP_DIR"
+
+// LoadLookupObjects reads all YAML and JSON files in the given directory and
+// its subdirectories, and returns the objects they contain, for use as
+// [TemplateOpts.LookupObjects]. Files are read in lexical order.
+func LoadLookupObjects(dir string) ([]map[string]any, error) {
+	objs := []map[string]any{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		fileObjs, err := kube.SplitYAML(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for _, obj := range fileObjs {
+			objs = append(objs, obj.Object)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lookup objects: %w", err)
+	}
+	return objs, nil
+}
@@ -0,0 +1,150 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/MacroPower/kclipper/pkg/argoutil/kube"
+)
+
+// CRDPlacement controls where CustomResourceDefinitions are placed in the
+// objects rendered by [Chart.Template] and [Chart.Release].
+type CRDPlacement string
+
+const (
+	// CRDPlacementInline leaves CRDs in place, mixed with all other objects.
+	CRDPlacementInline CRDPlacement = ""
+	// CRDPlacementFirst moves CRDs before all other objects.
+	CRDPlacementFirst CRDPlacement = "First"
+	// CRDPlacementSeparate returns CRDs separately from all other objects, in
+	// [Release.CRDs]. [Chart.Template] returns a single list of objects, so
+	// CRDs are placed first, in the same way as [CRDPlacementFirst].
+	CRDPlacementSeparate CRDPlacement = "Separate"
+)
+
+var ErrInvalidCRDPlacement = errors.New("invalid CRD placement")
+
+// installOrder maps each kind in Helm's [releaseutil.InstallOrder] to its
+// position in the install order.
+var installOrder = func() map[string]int {
+	order := make(map[string]int, len(releaseutil.InstallOrder))
+	for i, kind := range releaseutil.InstallOrder {
+		order[kind] = i
+	}
+	return order
+}()
+
+// FlattenLists replaces each object with a kind ending in "List" (e.g.
+// `v1/List` or `ConfigMapList`) with the objects in its `items`. Nested lists
+// are flattened recursively.
+func FlattenLists(objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	flat := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if !strings.HasSuffix(obj.GetKind(), "List") || !obj.IsList() {
+			flat = append(flat, obj)
+			continue
+		}
+		list, err := obj.ToList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to flatten %s: %w", objectRef(obj), err)
+		}
+		items := make([]*unstructured.Unstructured, 0, len(list.Items))
+		for i := range list.Items {
+			items = append(items, &list.Items[i])
+		}
+		items, err = FlattenLists(items)
+		if err != nil {
+			return nil, err
+		}
+		flat = append(flat, items...)
+	}
+	return flat, nil
+}
+
+// splitManifest splits a rendered manifest into individual Kubernetes objects.
+// If dropEmpty is set, documents without any fields (e.g. `{}`) are removed.
+// Otherwise, they are invalid objects. Empty and `null` documents are always
+// removed.
+func splitManifest(manifest string, dropEmpty bool) ([]*unstructured.Unstructured, error) {
+	if !dropEmpty {
+		return kube.SplitYAML([]byte(manifest))
+	}
+
+	docs, err := kube.SplitYAMLToString([]byte(manifest))
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]*unstructured.Unstructured, 0, len(docs))
+	for _, doc := range docs {
+		m := map[string]any{}
+		if err := yaml.Unmarshal([]byte(doc), &m); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+		}
+		if len(m) == 0 {
+			continue
+		}
+		u := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc), u); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+		}
+		objs = append(objs, u)
+	}
+	return objs, nil
+}
+
+// SortInstallOrder sorts objects by kind, in the order Helm installs them
+// (see [releaseutil.InstallOrder]). Kinds unknown to Helm are placed last,
+// sorted by kind. Objects of the same kind keep their rendered order.
+func SortInstallOrder(objs []*unstructured.Unstructured) {
+	slices.SortStableFunc(objs, func(a, b *unstructured.Unstructured) int {
+		ai, aok := installOrder[a.GetKind()]
+		bi, bok := installOrder[b.GetKind()]
+		switch {
+		case aok && bok:
+			return ai - bi
+		case aok:
+			return -1
+		case bok:
+			return 1
+		default:
+			return strings.Compare(a.GetKind(), b.GetKind())
+		}
+	})
+}
+
+// SplitCRDs splits objects into CustomResourceDefinitions and all other
+// objects, keeping their order.
+func SplitCRDs(objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured) {
+	crds := []*unstructured.Unstructured{}
+	others := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if isCRD(obj) {
+			crds = append(crds, obj)
+		} else {
+			others = append(others, obj)
+		}
+	}
+	return crds, others
+}
+
+// validateCRDPlacement returns an error if the given [CRDPlacement] is unknown.
+func validateCRDPlacement(p CRDPlacement) error {
+	switch p {
+	case CRDPlacementInline, CRDPlacementFirst, CRDPlacementSeparate:
+		return nil
+	default:
+		return fmt.Errorf("%w '%s': expected '%s' or '%s'", ErrInvalidCRDPlacement, p,
+			CRDPlacementFirst, CRDPlacementSeparate)
+	}
+}
+
+func isCRD(obj *unstructured.Unstructured) bool {
+	gk := obj.GroupVersionKind().GroupKind()
+	return gk.Group == "apiextensions.k8s.io" && gk.Kind == "CustomResourceDefinition"
+}
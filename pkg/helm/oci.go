@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"fmt"
+	"strings"
+
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+)
+
+// PinOCIRevision returns targetRevision pinned to the digest of the manifest
+// it currently refers to (e.g. "1.2.3@sha256:<digest>"), for the given chart
+// in an OCI repository. Charts pulled using the returned revision can never
+// change, even if the tag is later moved upstream. Revisions which already
+// include a digest are returned as-is.
+func (c *Client) PinOCIRevision(chart, repoURL, targetRevision string, creds Creds) (string, error) {
+	if !IsOCIRepoURL(repoURL) {
+		return "", fmt.Errorf("%w: %s", argohelm.ErrOCINotEnabled, repoURL)
+	}
+
+	tag, digest, err := argohelm.ParseOCIVersion(targetRevision)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse targetRevision '%s': %w", targetRevision, err)
+	}
+	if digest != "" {
+		return targetRevision, nil
+	}
+
+	argoCreds := argohelm.Creds{
+		Username:           creds.Username,
+		Password:           creds.Password,
+		CAPath:             creds.CAPath,
+		CertData:           creds.CertData,
+		KeyData:            creds.KeyData,
+		InsecureSkipVerify: creds.InsecureSkipVerify,
+	}
+	ahc := argohelm.NewClient(repoURL, argoCreds, true, c.Proxy, c.NoProxy)
+
+	digest, err = ahc.ResolveDigest(chart, tag)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of '%s:%s': %w", chart, tag, err)
+	}
+	return argohelm.FormatOCIVersion(tag, digest), nil
+}
+
+// IsOCIRepoURL returns true if repoURL is an OCI registry, i.e. it has no
+// scheme and is not a local path or git repository.
+func IsOCIRepoURL(repoURL string) bool {
+	if _, ok := gitRepoURL(repoURL); ok {
+		return false
+	}
+	if _, ok := localRepoPath(repoURL); ok {
+		return false
+	}
+	// OCI registries have no scheme, but may have a port.
+	return !strings.Contains(repoURL, "://")
+}
@@ -0,0 +1,75 @@
+package helm_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+	"github.com/MacroPower/kclipper/pkg/helm"
+)
+
+func TestPinOCIRevision(t *testing.T) {
+	t.Parallel()
+
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/charts/simple-chart/manifests/0.1.0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", "2")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	repoURL := serverURL.Host + "/charts"
+
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+	creds := helm.Creds{InsecureSkipVerify: true}
+
+	rev, err := client.PinOCIRevision("simple-chart", repoURL, "0.1.0", creds)
+	require.NoError(t, err)
+	require.Equal(t, "0.1.0@"+digest, rev)
+
+	// Pinned revisions are returned as-is.
+	rev, err = client.PinOCIRevision("simple-chart", repoURL, rev, creds)
+	require.NoError(t, err)
+	require.Equal(t, "0.1.0@"+digest, rev)
+
+	_, err = client.PinOCIRevision("simple-chart", repoURL, "0.2.0", creds)
+	require.Error(t, err)
+
+	for _, nonOCI := range []string{server.URL, "./testdata", "git+https://example.com/org/repo.git"} {
+		_, err = client.PinOCIRevision("simple-chart", nonOCI, "0.1.0", creds)
+		require.ErrorIs(t, err, argohelm.ErrOCINotEnabled)
+	}
+
+	_, err = client.PinOCIRevision("simple-chart", repoURL, "0.1.0@sha256:abc", creds)
+	require.ErrorIs(t, err, argohelm.ErrInvalidOCIDigest)
+}
+
+func TestIsOCIRepoURL(t *testing.T) {
+	t.Parallel()
+
+	for repoURL, want := range map[string]bool{
+		"ghcr.io/example/charts":               true,
+		"localhost:5000/charts":                true,
+		"https://example.com/charts":           false,
+		"https://example.com/chart-1.0.0.tgz":  false,
+		"git+https://example.com/org/repo.git": false,
+		"./charts":                             false,
+		"/charts":                              false,
+		"file:///charts":                       false,
+		"":                                     false,
+	} {
+		require.Equal(t, want, helm.IsOCIRepoURL(repoURL), repoURL)
+	}
+}
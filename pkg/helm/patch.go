@@ -0,0 +1,232 @@
+package helm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kustomize/api/filters/patchjson6902"
+	"sigs.k8s.io/kustomize/api/filters/patchstrategicmerge"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/resid"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	ErrInvalidPatch        = errors.New("invalid patch")
+	ErrPatchTargetRequired = errors.New("target is required for JSON 6902 patches")
+)
+
+// Patch is a Kustomize-style patch, which is applied to the objects rendered
+// by [Chart.Template] and [Chart.Release].
+type Patch struct {
+	// Patch is either a strategic merge patch, or a list of RFC 6902 JSON patch
+	// operations, in YAML or JSON format. The type of patch is detected from
+	// its content.
+	Patch string
+	// Target selects the objects the patch is applied to. If not set, a
+	// strategic merge patch is applied to objects matching its own group,
+	// version, kind, name and namespace. Target is required for JSON patches.
+	Target *PatchTarget
+}
+
+// PatchTarget selects objects in the same way as Kustomize's patch targets.
+// Group, Version, Kind, Name and Namespace are matched as anchored regular
+// expressions, and empty fields match all objects.
+type PatchTarget struct {
+	Group              string
+	Version            string
+	Kind               string
+	Name               string
+	Namespace          string
+	LabelSelector      string
+	AnnotationSelector string
+}
+
+func (t *PatchTarget) selector() *types.Selector {
+	return &types.Selector{
+		ResId: resid.ResId{
+			Gvk: resid.Gvk{
+				Group:   t.Group,
+				Version: t.Version,
+				Kind:    t.Kind,
+			},
+			Name:      t.Name,
+			Namespace: t.Namespace,
+		},
+		LabelSelector:      t.LabelSelector,
+		AnnotationSelector: t.AnnotationSelector,
+	}
+}
+
+// ApplyPatches applies each of the given patches, in order, to the given
+// objects. Objects may be removed by strategic merge patches using
+// `$patch: delete`.
+func ApplyPatches(objs []*unstructured.Unstructured, patches []Patch) ([]*unstructured.Unstructured, error) {
+	if len(patches) == 0 {
+		return objs, nil
+	}
+
+	nodes := make([]*kyaml.RNode, 0, len(objs))
+	for _, obj := range objs {
+		b, err := obj.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", objectRef(obj), err)
+		}
+		n, err := kyaml.Parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", objectRef(obj), err)
+		}
+		nodes = append(nodes, n)
+	}
+
+	for i, p := range patches {
+		var err error
+		nodes, err = applyPatch(nodes, p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply patch %d: %w", i, err)
+		}
+	}
+
+	result := make([]*unstructured.Unstructured, 0, len(nodes))
+	for _, n := range nodes {
+		b, err := n.MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal patched object: %w", err)
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(b); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal patched object: %w", err)
+		}
+		result = append(result, obj)
+	}
+
+	return result, nil
+}
+
+func applyPatch(nodes []*kyaml.RNode, p Patch) ([]*kyaml.RNode, error) {
+	jsonPatch, jsonErr := decodeJSONPatch(p.Patch)
+	if jsonErr == nil {
+		if p.Target == nil {
+			return nil, ErrPatchTargetRequired
+		}
+		return filterTargets(nodes, p.Target.selector(), patchjson6902.Filter{Patch: jsonPatch})
+	}
+
+	smPatches, smErr := kio.FromBytes([]byte(p.Patch))
+	if smErr != nil || len(smPatches) == 0 {
+		return nil, fmt.Errorf("%w: not a valid strategic merge patch (%w) or JSON patch (%w)",
+			ErrInvalidPatch, smErr, jsonErr)
+	}
+
+	var err error
+	for _, smp := range smPatches {
+		if smp.YNode().Kind != kyaml.MappingNode {
+			return nil, fmt.Errorf("%w: strategic merge patch must be a mapping", ErrInvalidPatch)
+		}
+		var sel *types.Selector
+		if p.Target != nil {
+			sel = p.Target.selector()
+		} else {
+			if smp.GetKind() == "" || smp.GetName() == "" {
+				return nil, fmt.Errorf("%w: strategic merge patch without a target must set kind and metadata.name",
+					ErrInvalidPatch)
+			}
+			sel = idSelector(resid.FromRNode(smp))
+		}
+		nodes, err = filterTargets(nodes, sel, patchstrategicmerge.Filter{Patch: smp})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nodes, nil
+}
+
+// idSelector returns a selector matching the given ID exactly.
+func idSelector(id resid.ResId) *types.Selector {
+	return &types.Selector{
+		ResId: resid.ResId{
+			Gvk: resid.Gvk{
+				Group:   regexp.QuoteMeta(id.Group),
+				Version: regexp.QuoteMeta(id.Version),
+				Kind:    regexp.QuoteMeta(id.Kind),
+			},
+			Name:      regexp.QuoteMeta(id.Name),
+			Namespace: regexp.QuoteMeta(id.Namespace),
+		},
+	}
+}
+
+// decodeJSONPatch returns the given patch in JSON format if it is a valid RFC
+// 6902 JSON patch in either YAML or JSON format.
+func decodeJSONPatch(patch string) (string, error) {
+	b, err := yaml.YAMLToJSON([]byte(patch))
+	if err != nil {
+		return "", fmt.Errorf("failed to convert to JSON: %w", err)
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		return "", errors.New("expected a list of operations")
+	}
+	if _, err := jsonpatch.DecodePatch(b); err != nil {
+		return "", fmt.Errorf("failed to decode: %w", err)
+	}
+	return string(b), nil
+}
+
+// filterTargets applies the filter to all nodes matching the selector. Nodes
+// that do not match are returned unchanged, in their original order.
+func filterTargets(nodes []*kyaml.RNode, sel *types.Selector, filter kio.Filter) ([]*kyaml.RNode, error) {
+	sr, err := types.NewSelectorRegex(sel)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid target: %w", ErrInvalidPatch, err)
+	}
+
+	result := make([]*kyaml.RNode, 0, len(nodes))
+	for _, n := range nodes {
+		match, err := matchesSelector(n, sel, sr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid target: %w", ErrInvalidPatch, err)
+		}
+		if !match {
+			result = append(result, n)
+			continue
+		}
+		filtered, err := filter.Filter([]*kyaml.RNode{n})
+		if err != nil {
+			return nil, fmt.Errorf("failed to patch %s %s: %w", n.GetKind(), n.GetName(), err)
+		}
+		result = append(result, filtered...)
+	}
+
+	return result, nil
+}
+
+func matchesSelector(n *kyaml.RNode, sel *types.Selector, sr *types.SelectorRegex) (bool, error) {
+	id := resid.FromRNode(n)
+	if !sr.MatchGvk(id.Gvk) || !sr.MatchName(id.Name) || !sr.MatchNamespace(id.Namespace) {
+		return false, nil
+	}
+	if sel.LabelSelector != "" {
+		match, err := n.MatchesLabelSelector(sel.LabelSelector)
+		if err != nil || !match {
+			return false, err //nolint:wrapcheck
+		}
+	}
+	if sel.AnnotationSelector != "" {
+		match, err := n.MatchesAnnotationSelector(sel.AnnotationSelector)
+		if err != nil || !match {
+			return false, err //nolint:wrapcheck
+		}
+	}
+	return true, nil
+}
+
+func objectRef(obj *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s %s", obj.GetKind(), obj.GetName())
+}
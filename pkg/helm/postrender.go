@@ -0,0 +1,65 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/postrender"
+)
+
+// DefaultPostRendererTimeout is the default [PostRendererExec.Timeout].
+const DefaultPostRendererTimeout = time.Minute
+
+var ErrPostRenderer = errors.New("post-renderer failed")
+
+var _ postrender.PostRenderer = &PostRendererExec{}
+
+// PostRendererExec is an executable which modifies the manifests rendered by a
+// chart, like Helm's `--post-renderer`. The rendered manifests are written to
+// its stdin, and the modified manifests are read from its stdout.
+type PostRendererExec struct {
+	// Command is the name or path of the executable.
+	Command string
+	// Args are the arguments passed to the executable.
+	Args []string
+	// Timeout is how long the executable may run before it is killed. Defaults
+	// to [DefaultPostRendererTimeout].
+	Timeout time.Duration
+}
+
+// Run implements [postrender.PostRenderer]. Errors include anything the
+// executable wrote to stderr.
+func (p *PostRendererExec) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPostRendererTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Stdin = renderedManifests
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait for any processes the executable started, which still hold
+	// its output open, after it is killed.
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %s timed out after %s", ErrPostRenderer, p.Command, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s: %w: %s", ErrPostRenderer, p.Command, err, msg)
+		}
+		return nil, fmt.Errorf("%w: %s: %w", ErrPostRenderer, p.Command, err)
+	}
+
+	return &stdout, nil
+}
@@ -0,0 +1,41 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/downloader"
+)
+
+var ErrProvenanceUnsupported = errors.New("provenance verification is not supported")
+
+// verifyProvenance verifies the packaged chart at archivePath using its
+// provenance file (i.e. archivePath + ".prov") and the given keyring.
+func verifyProvenance(archivePath, keyring string) error {
+	if _, err := downloader.VerifyChart(archivePath, keyring); err != nil {
+		return fmt.Errorf("failed to verify chart provenance: %w", err)
+	}
+	return nil
+}
+
+// verifyProvenanceData runs [verifyProvenance] on a packaged chart with the
+// given file name, and its provenance file, which are both in memory.
+func verifyProvenanceData(name string, data, provData []byte, keyring string) error {
+	dir, err := os.MkdirTemp("", "helm-prov")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	archivePath := filepath.Join(dir, filepath.Base(name))
+	if err := os.WriteFile(archivePath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write chart archive: %w", err)
+	}
+	if err := os.WriteFile(archivePath+".prov", provData, 0o600); err != nil {
+		return fmt.Errorf("failed to write provenance file: %w", err)
+	}
+
+	return verifyProvenance(archivePath, keyring)
+}
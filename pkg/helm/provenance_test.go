@@ -0,0 +1,160 @@
+package helm_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/repo"
+
+	"github.com/MacroPower/kclipper/pkg/helm"
+)
+
+// newProvenanceRepo serves a chart repository containing simple-chart twice:
+// signed by the test keyring under "/signed", and unsigned under "/unsigned".
+// It returns the server's URL and the repository directory.
+func newProvenanceRepo(t *testing.T) (string, string) {
+	t.Helper()
+
+	ch, err := loader.Load("testdata/simple-chart")
+	require.NoError(t, err)
+	signer, err := provenance.NewFromKeyring("testdata/provenance/secring.gpg", "kclipper test")
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	srv := httptest.NewServer(http.FileServer(http.Dir(root)))
+	t.Cleanup(srv.Close)
+
+	for _, name := range []string{"signed", "unsigned"} {
+		dir := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		archivePath, err := chartutil.Save(ch, dir)
+		require.NoError(t, err)
+		if name == "signed" {
+			sig, err := signer.ClearSign(archivePath)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(archivePath+".prov", []byte(sig), 0o600))
+		}
+		index, err := repo.IndexDirectory(dir, srv.URL+"/"+name)
+		require.NoError(t, err)
+		require.NoError(t, index.WriteFile(filepath.Join(dir, "index.yaml"), 0o600))
+	}
+
+	return srv.URL, root
+}
+
+func TestHelmChartProvenance(t *testing.T) {
+	t.Parallel()
+
+	srvURL, repoDir := newProvenanceRepo(t)
+	keyring, err := filepath.Abs("testdata/provenance/pubring.gpg")
+	require.NoError(t, err)
+	untrustedKeyring, err := filepath.Abs("testdata/provenance/untrusted-pubring.gpg")
+	require.NoError(t, err)
+
+	tcs := map[string]struct {
+		opts   helm.TemplateOpts
+		err    error
+		errMsg string
+	}{
+		"Repo": {
+			opts: helm.TemplateOpts{RepoURL: srvURL + "/signed", Keyring: keyring},
+		},
+		"RepoUntrusted": {
+			opts:   helm.TemplateOpts{RepoURL: srvURL + "/signed", Keyring: untrustedKeyring},
+			errMsg: "unknown entity",
+		},
+		"RepoUnsigned": {
+			opts:   helm.TemplateOpts{RepoURL: srvURL + "/unsigned", Keyring: keyring},
+			errMsg: "failed to fetch provenance",
+		},
+		"ArchiveURL": {
+			opts: helm.TemplateOpts{RepoURL: srvURL + "/signed/simple-chart-0.1.0.tgz", Keyring: keyring},
+		},
+		"ArchiveURLUntrusted": {
+			opts:   helm.TemplateOpts{RepoURL: srvURL + "/signed/simple-chart-0.1.0.tgz", Keyring: untrustedKeyring},
+			errMsg: "unknown entity",
+		},
+		"ArchiveURLUnsigned": {
+			opts:   helm.TemplateOpts{RepoURL: srvURL + "/unsigned/simple-chart-0.1.0.tgz", Keyring: keyring},
+			errMsg: "error downloading provenance file",
+		},
+		"LocalArchive": {
+			opts: helm.TemplateOpts{RepoURL: filepath.Join(repoDir, "signed", "simple-chart-0.1.0.tgz"), Keyring: keyring},
+		},
+		"LocalArchiveUnsigned": {
+			opts:   helm.TemplateOpts{RepoURL: filepath.Join(repoDir, "unsigned", "simple-chart-0.1.0.tgz"), Keyring: keyring},
+			errMsg: "failed to verify chart provenance",
+		},
+		"RelativeKeyring": {
+			opts: helm.TemplateOpts{
+				RepoURL:  srvURL + "/signed/simple-chart-0.1.0.tgz",
+				RepoRoot: "testdata",
+				Keyring:  "provenance/pubring.gpg",
+			},
+		},
+		"LocalDir": {
+			opts: helm.TemplateOpts{RepoURL: "./testdata", Keyring: keyring},
+			err:  helm.ErrProvenanceUnsupported,
+		},
+		"Git": {
+			opts: helm.TemplateOpts{RepoURL: "git+file:///repo.git", Keyring: keyring},
+			err:  helm.ErrProvenanceUnsupported,
+		},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			paths := helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder())
+			client := helm.MustNewClient(paths, "test", "10M")
+
+			opts := tc.opts
+			opts.ChartName = "simple-chart"
+			opts.TargetRevision = "0.1.0"
+			results, err := helm.NewChart(client, opts).Template()
+			if tc.err != nil || tc.errMsg != "" {
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+				}
+				require.ErrorContains(t, err, tc.errMsg)
+
+				// Charts which fail verification are never cached.
+				require.Empty(t, paths.GetPaths())
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, results)
+		})
+	}
+}
+
+func TestHelmChartProvenanceCache(t *testing.T) {
+	t.Parallel()
+
+	srvURL, _ := newProvenanceRepo(t)
+	keyring, err := filepath.Abs("testdata/provenance/pubring.gpg")
+	require.NoError(t, err)
+
+	client := helm.MustNewClient(helm.NewTempPaths(t.TempDir(), helm.NewBase64PathEncoder()), "test", "10M")
+	for _, repoURL := range []string{srvURL + "/unsigned", srvURL + "/unsigned/simple-chart-0.1.0.tgz"} {
+		opts := helm.TemplateOpts{
+			ChartName:      "simple-chart",
+			TargetRevision: "0.1.0",
+			RepoURL:        repoURL,
+		}
+		_, err := helm.NewChart(client, opts).Template()
+		require.NoError(t, err)
+
+		// Charts cached by unverified pulls are not used by verified pulls.
+		opts.Keyring = keyring
+		_, err = helm.NewChart(client, opts).Template()
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+)
+
+const (
+	// RenderCacheDirEnvVar is the environment variable containing the
+	// directory used by the helm plugin's render cache. The render cache is
+	// disabled if it is not set.
+	RenderCacheDirEnvVar = "KCLX_HELM_RENDER_CACHE_DIR"
+	// RenderCacheMaxSizeEnvVar is the environment variable containing the
+	// maximum size of the helm plugin's render cache, e.g. "500M".
+	RenderCacheMaxSizeEnvVar = "KCLX_HELM_RENDER_CACHE_MAX_SIZE"
+	// DefaultRenderCacheMaxSize is the default maximum size of a [RenderCache].
+	DefaultRenderCacheMaxSize = "256M"
+
+	renderCacheExt = ".yaml"
+)
+
+// RenderCache is an on-disk cache of rendered Helm manifests. Entries are
+// written atomically, so a RenderCache can be shared by concurrent processes.
+// When the total size of the cache exceeds its maximum size, the least
+// recently used entries are evicted.
+type RenderCache struct {
+	dir     string
+	maxSize int64
+}
+
+// NewRenderCache returns a new [RenderCache] storing entries in the given
+// directory, which is created if it does not exist. If maxSize is empty,
+// [DefaultRenderCacheMaxSize] is used.
+func NewRenderCache(dir, maxSize string) (*RenderCache, error) {
+	if maxSize == "" {
+		maxSize = DefaultRenderCacheMaxSize
+	}
+	maxSizeResource, err := resource.ParseQuantity(maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quantity '%s': %w", maxSize, err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create render cache directory: %w", err)
+	}
+
+	return &RenderCache{
+		dir:     dir,
+		maxSize: maxSizeResource.Value(),
+	}, nil
+}
+
+// Get returns the cached manifest for the given key, if it exists.
+func (rc *RenderCache) Get(key string) (string, bool) {
+	path := rc.keyToPath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	// Update the modification time, which is used for LRU eviction.
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return string(data), true
+}
+
+// Put stores the manifest for the given key, and then evicts the least
+// recently used entries until the cache is within its maximum size.
+func (rc *RenderCache) Put(key, manifest string) error {
+	if int64(len(manifest)) > rc.maxSize {
+		return nil
+	}
+
+	f, err := os.CreateTemp(rc.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create render cache entry: %w", err)
+	}
+	tmpPath := f.Name()
+	defer func() {
+		_ = os.Remove(tmpPath)
+	}()
+
+	_, err = io.WriteString(f, manifest)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write render cache entry: %w", err)
+	}
+	// Rename is atomic, so other processes never read a partial entry.
+	if err := os.Rename(tmpPath, rc.keyToPath(key)); err != nil {
+		return fmt.Errorf("failed to write render cache entry: %w", err)
+	}
+
+	return rc.evict()
+}
+
+// evict removes the least recently used entries until the total size of the
+// cache is within its maximum size. Entries removed concurrently by other
+// processes are ignored.
+func (rc *RenderCache) evict() error {
+	entries, err := os.ReadDir(rc.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read render cache directory: %w", err)
+	}
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	var size int64
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), renderCacheExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+		size += info.Size()
+	}
+	if size <= rc.maxSize {
+		return nil
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		if size <= rc.maxSize {
+			break
+		}
+		err := os.Remove(filepath.Join(rc.dir, info.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to evict render cache entry: %w", err)
+		}
+		size -= info.Size()
+	}
+
+	return nil
+}
+
+func (rc *RenderCache) keyToPath(key string) string {
+	return filepath.Join(rc.dir, key+renderCacheExt)
+}
+
+// renderCacheKey returns a key identifying the output of rendering the chart
+// at chartPath with the given options and values. Only options that affect the
+// output of the Helm engine, or whether rendering fails (e.g. strict
+// compatibility checks), are included.
+func renderCacheKey(chartPath string, opts *TemplateOpts, values map[string]any) (string, error) {
+	digest, err := argohelm.ChartDigest(chartPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the names and URLs of repositories are included, so credentials
+	// are never written to the key.
+	repos := make([]string, 0, len(opts.Repositories))
+	for _, r := range opts.Repositories {
+		repos = append(repos, fmt.Sprintf("%s=%s", r.Name, r.Repo))
+	}
+
+	// JSON encoding sorts map keys, so the values are canonicalised.
+	b, err := json.Marshal(struct {
+		ChartDigest          string           `json:"chartDigest"`
+		ChartName            string           `json:"chartName"`
+		ReleaseName          string           `json:"releaseName"`
+		Namespace            string           `json:"namespace"`
+		KubeVersion          string           `json:"kubeVersion"`
+		APIVersions          []string         `json:"apiVersions"`
+		Values               map[string]any   `json:"values"`
+		SkipCRDs             bool             `json:"skipCRDs"`
+		SkipSchemaValidation bool             `json:"skipSchemaValidation"`
+		StrictCompatibility  bool             `json:"strictCompatibility"`
+		IncludeHooks         bool             `json:"includeHooks"`
+		SkipTests            bool             `json:"skipTests"`
+		ShowOnly             []string         `json:"showOnly"`
+		LookupObjects        []map[string]any `json:"lookupObjects"`
+		Repositories         []string         `json:"repositories"`
+	}{
+		ChartDigest:          digest,
+		ChartName:            opts.ChartName,
+		ReleaseName:          opts.ReleaseName,
+		Namespace:            opts.Namespace,
+		KubeVersion:          opts.KubeVersion,
+		APIVersions:          opts.APIVersions,
+		Values:               values,
+		SkipCRDs:             opts.SkipCRDs,
+		SkipSchemaValidation: opts.SkipSchemaValidation,
+		StrictCompatibility:  opts.StrictCompatibility,
+		IncludeHooks:         opts.IncludeHooks,
+		SkipTests:            opts.SkipTests,
+		ShowOnly:             opts.ShowOnly,
+		LookupObjects:        opts.LookupObjects,
+		Repositories:         repos,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal render cache key: %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,156 @@
+package helm_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/MacroPower/kclipper/pkg/helm"
+	"github.com/MacroPower/kclipper/pkg/helmtest"
+)
+
+func TestRenderCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rc, err := helm.NewRenderCache(dir, "10")
+	require.NoError(t, err)
+
+	_, ok := rc.Get("a")
+	require.False(t, ok)
+
+	require.NoError(t, rc.Put("a", "aaaa"))
+	got, ok := rc.Get("a")
+	require.True(t, ok)
+	require.Equal(t, "aaaa", got)
+
+	// Make "a" the least recently used entry.
+	past := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "a.yaml"), past, past))
+
+	require.NoError(t, rc.Put("b", "bbbb"))
+	require.NoError(t, rc.Put("c", "cccc"))
+
+	_, ok = rc.Get("a")
+	require.False(t, ok, "least recently used entry should be evicted")
+	_, ok = rc.Get("b")
+	require.True(t, ok)
+	_, ok = rc.Get("c")
+	require.True(t, ok)
+
+	// Entries larger than the cache are not stored.
+	require.NoError(t, rc.Put("d", strings.Repeat("d", 11)))
+	_, ok = rc.Get("d")
+	require.False(t, ok)
+}
+
+func TestRenderCacheConcurrent(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	wg := sync.WaitGroup{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Use a separate cache for each writer, like separate processes.
+			rc, err := helm.NewRenderCache(dir, "1Ki")
+			if !assert.NoError(t, err) {
+				return
+			}
+			for range 20 {
+				assert.NoError(t, rc.Put("key", strings.Repeat("x", 100)))
+				if got, ok := rc.Get("key"); ok {
+					assert.Len(t, got, 100)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary files should be cleaned up")
+}
+
+func TestHelmChartRenderCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rc, err := helm.NewRenderCache(dir, "")
+	require.NoError(t, err)
+
+	newChart := func(replicas int) *helm.Chart {
+		return helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+			ChartName:    "simple-chart",
+			RepoURL:      "./testdata",
+			ValuesObject: map[string]any{"replicaCount": replicas},
+		}, helm.WithRenderCache(rc))
+	}
+
+	want, err := newChart(2).Template()
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	got, err := newChart(2).Template()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// Different values use a different entry.
+	_, err = newChart(3).Template()
+	require.NoError(t, err)
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Cached output is returned without rendering the chart.
+	for _, e := range entries {
+		err := os.WriteFile(filepath.Join(dir, e.Name()), []byte("apiVersion: v1\nkind: ConfigMap\n"), 0o600)
+		require.NoError(t, err)
+	}
+	got, err = newChart(2).Template()
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, "ConfigMap", got[0].GetKind())
+}
+
+func TestHelmChartRenderCacheStrictCompatibility(t *testing.T) {
+	t.Parallel()
+
+	ch, err := loader.Load("testdata/simple-chart")
+	require.NoError(t, err)
+	ch.Metadata.Deprecated = true
+	repoDir := t.TempDir()
+	require.NoError(t, chartutil.SaveDir(ch, repoDir))
+
+	rc, err := helm.NewRenderCache(t.TempDir(), "")
+	require.NoError(t, err)
+
+	newChart := func(strict bool) *helm.Chart {
+		return helm.NewChart(helmtest.DefaultTestClient, helm.TemplateOpts{
+			ChartName:           "simple-chart",
+			RepoURL:             repoDir,
+			StrictCompatibility: strict,
+		}, helm.WithRenderCache(rc))
+	}
+
+	_, err = newChart(false).Template()
+	require.NoError(t, err)
+
+	// Cached non-strict renders are not used by strict renders.
+	_, err = newChart(true).Template()
+	require.ErrorContains(t, err, "deprecated")
+}
@@ -0,0 +1,292 @@
+package helm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+)
+
+// valuesSchemaURL is the URL of each chart's values schema. Relative references
+// in the schema are resolved to files in the chart.
+const valuesSchemaURL = "file:///values.schema.json"
+
+var (
+	ErrValuesSchema = errors.New("values do not match the chart's schema")
+
+	compiledSchemas   = map[string]*jsonschema.Schema{}
+	compiledSchemasMu sync.Mutex
+
+	schemaErrorPrinter = message.NewPrinter(language.English)
+)
+
+// SchemaViolation is a value which does not match a chart's values schema.
+type SchemaViolation struct {
+	// Pointer is the JSON pointer of the value, e.g. "/image/tag". Values of
+	// sub charts are nested under the sub chart's name or alias.
+	Pointer string
+	// Message describes the violation.
+	Message string
+}
+
+// ValuesSchemaError is returned when values do not match the values schema of
+// a chart or any of its sub charts. It lists every violation, sorted by
+// pointer.
+type ValuesSchemaError struct {
+	Chart      string
+	Violations []SchemaViolation
+}
+
+func (e *ValuesSchemaError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s:", e.Chart, ErrValuesSchema)
+	for _, v := range e.Violations {
+		pointer := v.Pointer
+		if pointer == "" {
+			pointer = "/"
+		}
+		fmt.Fprintf(&sb, "\n  - %s: %s", pointer, v.Message)
+	}
+	return sb.String()
+}
+
+func (e *ValuesSchemaError) Unwrap() error {
+	return ErrValuesSchema
+}
+
+// PullSchemaRef downloads the JSON schema referenced at the given HTTP(S) URL.
+// Downloaded schemas are stored in the injected [PathCacher], and subsequent
+// requests will use [PathCacher] rather than re-downloading the schema.
+func (c *Client) PullSchemaRef(refURL string) ([]byte, error) {
+	data, err := c.pullFile(refURL, "schema", Creds{})
+	if err != nil {
+		return nil, fmt.Errorf("error downloading schema: %w", err)
+	}
+	return data, nil
+}
+
+// validateValues validates the given values, coalesced with the chart's
+// default values, against the values schema of the chart at chartPath and any
+// enabled sub charts in its `charts/` directory, in the same way as Helm.
+// Compiled schemas are cached for each chart digest.
+func (c *Chart) validateValues(chartPath string, values map[string]any) error {
+	ch, err := c.loadChart(chartPath)
+	if err != nil {
+		return err
+	}
+	digest, err := argohelm.ChartDigest(chartPath)
+	if err != nil {
+		return fmt.Errorf("error validating values: %w", err)
+	}
+
+	coalesced, err := chartutil.CoalesceValues(ch, values)
+	if err != nil {
+		return fmt.Errorf("error coalescing values: %w", err)
+	}
+
+	violations, err := c.schemaViolations(ch, digest, coalesced.AsMap(), "")
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		slices.SortStableFunc(violations, func(a, b SchemaViolation) int {
+			return strings.Compare(a.Pointer, b.Pointer)
+		})
+		return &ValuesSchemaError{Chart: ch.Name(), Violations: violations}
+	}
+
+	return nil
+}
+
+// schemaViolations returns the violations of the values schema of ch and its
+// enabled sub charts. prefix is the JSON pointer of the chart's values.
+func (c *Chart) schemaViolations(
+	ch *chart.Chart, digest string, values map[string]any, prefix string,
+) ([]SchemaViolation, error) {
+	violations := []SchemaViolation{}
+
+	if len(ch.Schema) > 0 {
+		sch, err := c.compileSchema(ch, digest+"\x00"+ch.ChartFullPath())
+		if err != nil {
+			return nil, err
+		}
+		if err := sch.Validate(values); err != nil {
+			var vErr *jsonschema.ValidationError
+			if !errors.As(err, &vErr) {
+				return nil, fmt.Errorf("error validating values: %w", err)
+			}
+			violations = append(violations, leafViolations(vErr, prefix)...)
+		}
+	}
+
+	for _, sub := range ch.Dependencies() {
+		for _, key := range enabledDependencyKeys(ch, sub, values) {
+			subValues, _ := values[key].(map[string]any)
+			if subValues == nil {
+				subValues = map[string]any{}
+			}
+			subViolations, err := c.schemaViolations(sub, digest, subValues, prefix+"/"+escapePointer(key))
+			if err != nil {
+				return nil, err
+			}
+			violations = append(violations, subViolations...)
+		}
+	}
+
+	return violations, nil
+}
+
+// compileSchema compiles the values schema of ch, or returns the schema
+// previously compiled with the same key. Relative references are resolved to
+// files in the chart, and HTTP(S) references are pulled using
+// [ChartClient.PullSchemaRef].
+func (c *Chart) compileSchema(ch *chart.Chart, key string) (*jsonschema.Schema, error) {
+	compiledSchemasMu.Lock()
+	defer compiledSchemasMu.Unlock()
+
+	if sch, ok := compiledSchemas[key]; ok {
+		return sch, nil
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(ch.Schema))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse values schema of '%s': %w", ch.ChartFullPath(), err)
+	}
+
+	refLoader := &schemaRefLoader{client: c.Client}
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(jsonschema.SchemeURLLoader{
+		"file":  &chartFileLoader{chart: ch},
+		"http":  refLoader,
+		"https": refLoader,
+	})
+	if err := compiler.AddResource(valuesSchemaURL, doc); err != nil {
+		return nil, fmt.Errorf("failed to add values schema of '%s': %w", ch.ChartFullPath(), err)
+	}
+	sch, err := compiler.Compile(valuesSchemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile values schema of '%s': %w", ch.ChartFullPath(), err)
+	}
+	compiledSchemas[key] = sch
+
+	return sch, nil
+}
+
+// enabledDependencyKeys returns the values keys (names or aliases) of each
+// enabled dependency of ch which uses the sub chart sub. Dependencies are
+// enabled unless their `condition` is false in the given values.
+func enabledDependencyKeys(ch, sub *chart.Chart, values map[string]any) []string {
+	keys := []string{}
+	for _, dep := range ch.Metadata.Dependencies {
+		if dep.Name != sub.Name() || !dependencyEnabled(dep, chartutil.Values(values)) {
+			continue
+		}
+		key := dep.Name
+		if dep.Alias != "" {
+			key = dep.Alias
+		}
+		keys = append(keys, key)
+	}
+	if len(ch.Metadata.Dependencies) == 0 {
+		keys = append(keys, sub.Name())
+	}
+	return keys
+}
+
+// dependencyEnabled returns false if the first of the dependency's conditions
+// found in the given values is false.
+func dependencyEnabled(dep *chart.Dependency, values chartutil.Values) bool {
+	for _, cond := range strings.Split(dep.Condition, ",") {
+		cond = strings.TrimSpace(cond)
+		if cond == "" {
+			continue
+		}
+		v, err := values.PathValue(cond)
+		if err != nil {
+			continue
+		}
+		if enabled, ok := v.(bool); ok {
+			return enabled
+		}
+	}
+	return true
+}
+
+// leafViolations returns a [SchemaViolation] for each leaf of the given
+// validation error's tree of causes. prefix is prepended to each pointer.
+func leafViolations(err *jsonschema.ValidationError, prefix string) []SchemaViolation {
+	if len(err.Causes) == 0 {
+		pointer := prefix
+		for _, token := range err.InstanceLocation {
+			pointer += "/" + escapePointer(token)
+		}
+		return []SchemaViolation{{
+			Pointer: pointer,
+			Message: err.ErrorKind.LocalizedString(schemaErrorPrinter),
+		}}
+	}
+	violations := []SchemaViolation{}
+	for _, cause := range err.Causes {
+		violations = append(violations, leafViolations(cause, prefix)...)
+	}
+	return violations
+}
+
+// escapePointer escapes a JSON pointer token (see RFC 6901).
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// chartFileLoader loads schemas referenced using relative or `file://` URLs
+// from the files in a chart, relative to the chart's root.
+type chartFileLoader struct {
+	chart *chart.Chart
+}
+
+func (l *chartFileLoader) Load(fileURL string) (any, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema url: %w", err)
+	}
+	name := strings.TrimPrefix(path.Clean(u.Path), "/")
+	for _, f := range l.chart.Raw {
+		if f.Name == name {
+			doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(f.Data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse schema '%s': %w", name, err)
+			}
+			return doc, nil
+		}
+	}
+	return nil, fmt.Errorf("schema '%s' not found in chart '%s'", name, l.chart.Name())
+}
+
+// schemaRefLoader loads schemas referenced using HTTP(S) URLs, using the local
+// cache of a [ChartClient].
+type schemaRefLoader struct {
+	client ChartClient
+}
+
+func (l *schemaRefLoader) Load(refURL string) (any, error) {
+	data, err := l.client.PullSchemaRef(refURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema '%s': %w", refURL, err)
+	}
+	return doc, nil
+}
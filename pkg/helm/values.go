@@ -0,0 +1,302 @@
+package helm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/copystructure"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/strvals"
+
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+	"github.com/MacroPower/kclipper/pkg/argoutil/sync"
+)
+
+var (
+	ErrValueFileNotFound    = errors.New("value file not found")
+	ErrLocalFileOutsideRoot = errors.New("local file must be within the repository root")
+
+	valueFileLock = sync.NewKeyLock()
+)
+
+// PullValueFile downloads the value file at the given HTTP(S) URL. Downloaded
+// files are stored in the injected [PathCacher], and subsequent requests will
+// use [PathCacher] rather than re-downloading the file.
+func (c *Client) PullValueFile(fileURL string, creds Creds) ([]byte, error) {
+	data, err := c.pullFile(fileURL, "values", creds)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading value file: %w", err)
+	}
+	return data, nil
+}
+
+// pullFile downloads the file at the given HTTP(S) URL, using the injected
+// [PathCacher]. fileType distinguishes the cached files of different types.
+func (c *Client) pullFile(fileURL, fileType string, creds Creds) ([]byte, error) {
+	keyData, err := json.Marshal(map[string]string{
+		"url":     fileURL,
+		"type":    fileType,
+		"project": c.cacheProject(creds),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cache key data: %w", err)
+	}
+	cachedPath, err := c.Paths.GetPath(string(keyData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value file cache path: %w", err)
+	}
+
+	valueFileLock.Lock(cachedPath)
+	defer valueFileLock.Unlock(cachedPath)
+
+	if data, err := os.ReadFile(cachedPath); err == nil {
+		return data, nil
+	}
+
+	data, err := c.downloadFile(fileURL, creds)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCacheFile(cachedPath, fileType, data); err != nil {
+		return nil, err
+	}
+	if err := c.sealCachedPath(cachedPath); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// downloadFile downloads the file at the given HTTP(S) URL, up to the
+// client's MaxExtractSize.
+func (c *Client) downloadFile(fileURL string, creds Creds) ([]byte, error) {
+	data, err := argohelm.DownloadFile(fileURL, argohelm.Creds{
+		Username:           creds.Username,
+		Password:           creds.Password,
+		CAPath:             creds.CAPath,
+		CertData:           creds.CertData,
+		KeyData:            creds.KeyData,
+		InsecureSkipVerify: creds.InsecureSkipVerify,
+	}, c.Proxy, c.NoProxy, c.MaxExtractSize.Value())
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// writeCacheFile atomically writes data to cachedPath, via a temporary file.
+func writeCacheFile(cachedPath, fileType string, data []byte) error {
+	// Create the temporary file next to cachedPath, so that it can always be
+	// renamed into place (os.Rename fails across filesystems).
+	f, err := os.CreateTemp(filepath.Dir(cachedPath), "helm-"+fileType)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := f.Name()
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmpPath, cachedPath); err != nil {
+		return fmt.Errorf("failed to rename file from %s to %s: %w", tmpPath, cachedPath, err)
+	}
+
+	return nil
+}
+
+// values returns the values used to render the chart at chartPath. Each of
+// the [TemplateOpts.ValueFiles] is merged in order, followed by the
+// [TemplateOpts.ValuesObject], and then the [TemplateOpts.Set],
+// [TemplateOpts.SetString] and [TemplateOpts.SetFile] overrides, with the
+// same precedence as Helm's `--values`, `--set`, `--set-string` and
+// `--set-file` flags.
+func (c *Chart) values(chartPath string) (map[string]any, error) {
+	opts := &c.TemplateOpts
+	if len(opts.ValueFiles) == 0 && len(opts.Set) == 0 && len(opts.SetString) == 0 && len(opts.SetFile) == 0 {
+		return opts.ValuesObject, nil
+	}
+
+	// The chart is only loaded if a value file is read from the chart.
+	var ch *chart.Chart
+	loadChart := func() (*chart.Chart, error) {
+		if ch != nil {
+			return ch, nil
+		}
+		var err error
+		ch, err = c.loadChart(chartPath)
+		return ch, err
+	}
+
+	values := map[string]any{}
+	for _, vf := range opts.ValueFiles {
+		data, err := c.readValueFile(vf, loadChart)
+		if errors.Is(err, ErrValueFileNotFound) && opts.IgnoreMissingValueFiles {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fileValues, err := chartutil.ReadValues(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse value file '%s': %w", vf, err)
+		}
+		values = mergeValues(values, fileValues)
+	}
+	values = mergeValues(values, opts.ValuesObject)
+
+	if len(opts.Set) == 0 && len(opts.SetString) == 0 && len(opts.SetFile) == 0 {
+		return values, nil
+	}
+
+	// Overrides modify nested maps in place, so the values must be copied to
+	// avoid modifying the ValuesObject.
+	valuesCopy, err := copystructure.Copy(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy values: %w", err)
+	}
+	values, _ = valuesCopy.(map[string]any)
+
+	for _, s := range opts.Set {
+		if err := strvals.ParseInto(s, values); err != nil {
+			return nil, fmt.Errorf("failed to parse set '%s': %w", s, err)
+		}
+	}
+	for _, s := range opts.SetString {
+		if err := strvals.ParseIntoString(s, values); err != nil {
+			return nil, fmt.Errorf("failed to parse set_string '%s': %w", s, err)
+		}
+	}
+	for _, s := range opts.SetFile {
+		if err := strvals.ParseIntoFile(s, values, c.readSetFile); err != nil {
+			return nil, fmt.Errorf("failed to parse set_file '%s': %w", s, err)
+		}
+	}
+
+	return values, nil
+}
+
+// loadChart loads the chart at chartPath, using the [argohelm.ChartCache] if
+// one is configured.
+func (c *Chart) loadChart(chartPath string) (*chart.Chart, error) {
+	load := loader.Load
+	if c.ChartCache != nil {
+		load = c.ChartCache.Load
+	}
+	ch, err := load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading helm chart: %w", err)
+	}
+	return ch, nil
+}
+
+// readSetFile reads the value of a `--set-file` override from a local file.
+// Relative paths are resolved from the RepoRoot, if it is set.
+func (c *Chart) readSetFile(rs []rune) (any, error) {
+	path, err := c.localPath(string(rs))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return string(data), nil
+}
+
+// localPath returns the path of a local file used to render the chart. If
+// RepoRoot is set, relative paths are resolved from RepoRoot, and an error is
+// returned if the file is outside of RepoRoot. Otherwise, relative paths are
+// resolved from the current working directory.
+func (c *Chart) localPath(path string) (string, error) {
+	if c.TemplateOpts.RepoRoot == "" {
+		return path, nil
+	}
+
+	root, err := filepath.Abs(c.TemplateOpts.RepoRoot)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	if !withinDir(root, path) {
+		return "", fmt.Errorf("%w '%s': %s", ErrLocalFileOutsideRoot, root, path)
+	}
+	return path, nil
+}
+
+// readValueFile reads a value file, which is either an HTTP(S) URL, a local
+// path, or a path relative to the root of the chart returned by loadChart.
+// Local paths take precedence over files in the chart, and are resolved using
+// [Chart.localPath].
+func (c *Chart) readValueFile(valueFile string, loadChart func() (*chart.Chart, error)) ([]byte, error) {
+	if u, err := url.Parse(valueFile); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		creds := Creds{}
+		if c.TemplateOpts.PassCredentials || sameHost(valueFile, c.TemplateOpts.RepoURL) {
+			creds = c.TemplateOpts.Credentials
+		}
+		data, err := c.Client.PullValueFile(valueFile, creds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull value file '%s': %w", valueFile, err)
+		}
+		return data, nil
+	}
+
+	localPath, err := c.localPath(valueFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read value file: %w", err)
+	}
+	data, err := os.ReadFile(localPath)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read value file '%s': %w", valueFile, err)
+	}
+	if !filepath.IsLocal(valueFile) {
+		return nil, fmt.Errorf("%w: %s", ErrValueFileNotFound, valueFile)
+	}
+
+	ch, err := loadChart()
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.ToSlash(filepath.Clean(valueFile))
+	for _, f := range ch.Raw {
+		if f.Name == name {
+			return f.Data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrValueFileNotFound, valueFile)
+}
+
+// mergeValues merges b into a copy of a, recursively merging any maps, in the
+// same way as values passed to Helm using multiple `--values` flags.
+func mergeValues(a, b map[string]any) map[string]any {
+	out := make(map[string]any, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]any); ok {
+			if bv, ok := out[k].(map[string]any); ok {
+				out[k] = mergeValues(bv, v)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
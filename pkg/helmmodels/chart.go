@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/iancoleman/strcase"
+	invopopjsonschema "github.com/invopop/jsonschema"
 	"kcl-lang.io/kcl-go/pkg/tools/gen"
 
 	"github.com/MacroPower/kclipper/pkg/jsonschema"
@@ -19,8 +20,9 @@ type ChartData struct {
 type ChartBase struct {
 	// Chart is the Helm chart name.
 	Chart string `json:"chart" jsonschema:"description=The Helm chart name."`
-	// RepoURL is the URL of the Helm chart repository.
-	RepoURL string `json:"repoURL" jsonschema:"description=The URL of the Helm chart repository."`
+	// RepoURL is the URL of the Helm chart repository, or the path of a local
+	// chart repository or packaged chart.
+	RepoURL string `json:"repoURL" jsonschema:"description=The URL of the Helm chart repository. Local chart repositories and packaged charts are given as paths relative to the KCL module root."`
 	// TargetRevision is the semver tag for the chart's version.
 	TargetRevision string `json:"targetRevision" jsonschema:"description=The semver tag for the chart's version."`
 	// ReleaseName is the Helm release name to use. If omitted it will use the chart name.
@@ -29,8 +31,86 @@ type ChartBase struct {
 	SkipCRDs bool `json:"skipCRDs,omitempty" jsonschema:"-,description=Skip the custom resource definition installation step."`
 	// PassCredentials will pass credentials to all domains (--pass-credentials).
 	PassCredentials bool `json:"passCredentials,omitempty" jsonschema:"-,description=Pass credentials to all domains."`
+	// StrictCompatibility will fail when the chart is deprecated or incompatible with the Kubernetes version.
+	StrictCompatibility bool `json:"strictCompatibility,omitempty" jsonschema:"-,description=Fail when the chart is deprecated or incompatible with the Kubernetes version."`
+	// KubeVersion is the Kubernetes version to template with (--kube-version).
+	KubeVersion string `json:"kubeVersion,omitempty" jsonschema:"-,description=The Kubernetes version to template with."`
+	// APIVersions are the Kubernetes API versions to template with (--api-versions).
+	APIVersions []string `json:"apiVersions,omitempty" jsonschema:"-,description=The Kubernetes API versions to template with."`
+	// Capabilities is the name of the cluster capability profile to template with.
+	Capabilities string `json:"capabilities,omitempty" jsonschema:"-,description=The name of the cluster capability profile to template with."`
+	// Repositories are used to resolve the chart's dependencies.
+	Repositories []ChartRepository `json:"repositories,omitempty" jsonschema:"-,description=Helm chart repositories used to resolve the chart's dependencies."`
+	// IncludeHooks will include hook resources in the output.
+	IncludeHooks bool `json:"includeHooks,omitempty" jsonschema:"-,description=Include hook resources in the output."`
+	// SkipTests will exclude test hooks from the output (--skip-tests).
+	SkipTests bool `json:"skipTests,omitempty" jsonschema:"-,description=Exclude test hooks from the output."`
+	// ShowOnly will only output manifests rendered from the given templates (--show-only).
+	ShowOnly []string `json:"showOnly,omitempty" jsonschema:"-,description=Only output manifests rendered from the given templates."`
+	// Patches are Kustomize-style patches applied to the rendered resources.
+	Patches []ChartPatch `json:"patches,omitempty" jsonschema:"-,description=Kustomize-style patches applied to the rendered resources."`
+	// LookupObjects are returned by Helm's `lookup` template function.
+	LookupObjects []map[string]any `json:"lookupObjects,omitempty" jsonschema:"-,description=Objects returned by Helm's lookup template function."`
+	// LookupDir is a directory of objects returned by Helm's `lookup` template function.
+	LookupDir string `json:"lookupDir,omitempty" jsonschema:"-,description=A directory of objects returned by Helm's lookup template function."`
+	// ShowTemplateOnError will include the offending template in render errors.
+	ShowTemplateOnError bool `json:"showTemplateOnError,omitempty" jsonschema:"-,description=Include the offending template in render errors."`
+	// InjectNamespace will set the namespace on namespaced resources without one.
+	InjectNamespace bool `json:"injectNamespace,omitempty" jsonschema:"-,description=Set the namespace on namespaced resources without one."`
+	// FlattenLists will replace List resources with their items.
+	FlattenLists bool `json:"flattenLists,omitempty" jsonschema:"-,description=Replace List resources with their items."`
+	// DropEmpty will remove empty resources.
+	DropEmpty bool `json:"dropEmpty,omitempty" jsonschema:"-,description=Remove empty resources."`
+	// SortInstallOrder will sort resources in the order Helm installs them.
+	SortInstallOrder bool `json:"sortInstallOrder,omitempty" jsonschema:"-,description=Sort resources in the order Helm installs them."`
+	// CRDPlacement controls where custom resource definitions are placed.
+	CRDPlacement string `json:"crdPlacement,omitempty" jsonschema:"-,description=Where to place custom resource definitions."`
 	// SchemaValidator is the validator to use for the Values schema.
 	SchemaValidator jsonschema.ValidatorType `json:"schemaValidator,omitempty" jsonschema:"-,description=The validator to use for the Values schema."`
+	// Path is the path of the chart within a git repository.
+	Path string `json:"path,omitempty" jsonschema:"-,description=The path of the chart within a git repository."`
+	// PostRendererExec is an executable which modifies the rendered resources.
+	PostRendererExec *ChartPostRendererExec `json:"postRendererExec,omitempty" jsonschema:"-,description=An executable which modifies the rendered resources."`
+	// Keyring is the path of a keyring used to verify the chart's provenance.
+	Keyring string `json:"keyring,omitempty" jsonschema:"-,description=The path of a keyring used to verify the chart's provenance."`
+}
+
+// ChartRepository represents the KCL schema `helm.ChartRepository`.
+type ChartRepository struct {
+	// Name is the name used to reference the repository (e.g. "@name").
+	Name string `json:"name"`
+	// URL is the URL of the Helm chart repository.
+	URL string `json:"url"`
+	// Username is the username used to authenticate to the repository.
+	Username string `json:"username,omitempty"`
+	// Password is the password used to authenticate to the repository.
+	Password string `json:"password,omitempty"`
+}
+
+// ChartPatch represents the KCL schema `helm.ChartPatch`.
+type ChartPatch struct {
+	// Patch is a strategic merge patch, or a list of JSON 6902 patch operations.
+	Patch any `json:"patch"`
+	// Target selects the resources to patch.
+	Target *ChartPatchTarget `json:"target,omitempty"`
+}
+
+// ChartPatchTarget represents the KCL schema `helm.ChartPatchTarget`.
+type ChartPatchTarget struct {
+	// Group matches the resource's API group.
+	Group string `json:"group,omitempty"`
+	// Version matches the resource's API version.
+	Version string `json:"version,omitempty"`
+	// Kind matches the resource's kind.
+	Kind string `json:"kind,omitempty"`
+	// Name matches the resource's name.
+	Name string `json:"name,omitempty"`
+	// Namespace matches the resource's namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// LabelSelector matches the resource's labels.
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// AnnotationSelector matches the resource's annotations.
+	AnnotationSelector string `json:"annotationSelector,omitempty"`
 }
 
 type ChartConfig struct {
@@ -107,6 +187,15 @@ func (c *Chart) GenerateKCL(b *bytes.Buffer) error {
 		}
 		cv.Enum = jsonschema.ValidatorTypeEnum
 	}
+	if c.Keyring != "" {
+		// The keyring is only included when it is set, so that the chart's
+		// provenance is also verified when the chart is rendered.
+		js.Properties.Set("keyring", &invopopjsonschema.Schema{
+			Type:        "string",
+			Description: "The path of a keyring used to verify the chart's provenance.",
+			Default:     c.Keyring,
+		})
+	}
 
 	jsBytes, err := js.MarshalJSON()
 	if err != nil {
@@ -122,3 +211,13 @@ func (c *Chart) GenerateKCL(b *bytes.Buffer) error {
 
 	return nil
 }
+
+// ChartPostRendererExec represents the KCL schema `helm.ChartPostRendererExec`.
+type ChartPostRendererExec struct {
+	// Command is the name or path of the executable.
+	Command string `json:"command"`
+	// Args are the arguments passed to the executable.
+	Args []string `json:"args,omitempty"`
+	// Timeout is how long the executable may run before it is killed.
+	Timeout string `json:"timeout,omitempty"`
+}
@@ -25,6 +25,10 @@ func init() {
 
 type ChartClient interface {
 	Pull(chart, repoURL, targetRevision string, extract bool) (string, io.Closer, error)
+	PullValueFile(fileURL string, creds helm.Creds) ([]byte, error)
+	PullSchemaRef(refURL string) ([]byte, error)
+	BuildDependencies(chartPath string, opts helm.DependencyOpts) (string, io.Closer, error)
+	PinOCIRevision(chart, repoURL, targetRevision string, creds helm.Creds) (string, error)
 }
 
 type TestClient struct {
@@ -32,11 +36,11 @@ type TestClient struct {
 }
 
 func (c *TestClient) Pull(chart, repoURL, targetRevision string, extract bool) (string, io.Closer, error) {
-	return c.PullWithCreds(chart, repoURL, targetRevision, helm.Creds{}, extract, false)
+	return c.PullWithCreds(chart, repoURL, targetRevision, helm.Creds{}, "", extract, false)
 }
 
 func (c *TestClient) PullWithCreds(
-	chart, repoURL, targetRevision string, _ helm.Creds, extract, _ bool,
+	chart, repoURL, targetRevision string, _ helm.Creds, _ string, extract, _ bool,
 ) (string, io.Closer, error) {
 	chartPath, closer, err := c.BaseClient.Pull(chart, repoURL, targetRevision, extract)
 	if err != nil {
@@ -44,3 +48,35 @@ func (c *TestClient) PullWithCreds(
 	}
 	return chartPath, closer, nil
 }
+
+func (c *TestClient) PullValueFile(fileURL string, creds helm.Creds) ([]byte, error) {
+	data, err := c.BaseClient.PullValueFile(fileURL, creds)
+	if err != nil {
+		return nil, fmt.Errorf("error pulling value file: %w", err)
+	}
+	return data, nil
+}
+
+func (c *TestClient) PullSchemaRef(refURL string) ([]byte, error) {
+	data, err := c.BaseClient.PullSchemaRef(refURL)
+	if err != nil {
+		return nil, fmt.Errorf("error pulling schema: %w", err)
+	}
+	return data, nil
+}
+
+func (c *TestClient) BuildDependencies(chartPath string, opts helm.DependencyOpts) (string, io.Closer, error) {
+	builtPath, closer, err := c.BaseClient.BuildDependencies(chartPath, opts)
+	if err != nil {
+		return "", closer, fmt.Errorf("error building helm chart dependencies: %w", err)
+	}
+	return builtPath, closer, nil
+}
+
+func (c *TestClient) PinOCIRevision(chart, repoURL, targetRevision string, creds helm.Creds) (string, error) {
+	rev, err := c.BaseClient.PinOCIRevision(chart, repoURL, targetRevision, creds)
+	if err != nil {
+		return "", fmt.Errorf("error pinning OCI chart revision: %w", err)
+	}
+	return rev, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
@@ -30,21 +31,65 @@ charts: helm.Charts = {}
 `
 
 func (c *ChartPkg) Add(
-	chart, repoURL, targetRevision, schemaPath string,
+	chart, repoURL, targetRevision, schemaPath, keyring string,
 	genType jsonschema.GeneratorType,
 	validateType jsonschema.ValidatorType,
 ) error {
+	return c.add(helmmodels.ChartConfig{
+		ChartBase: helmmodels.ChartBase{
+			Chart:           chart,
+			RepoURL:         repoURL,
+			TargetRevision:  targetRevision,
+			SchemaValidator: validateType,
+			Keyring:         keyring,
+		},
+		SchemaGenerator: genType,
+		SchemaPath:      schemaPath,
+	})
+}
+
+// add generates the chart package for the given chart configuration. If the
+// configuration has a keyring, the chart's provenance is verified using the
+// keyring, and the keyring is set in the generated chart.k so the chart is
+// also verified when it is rendered. Like local repositories, relative
+// keyrings are resolved from the KCL module root, which is the working
+// directory of chart commands. If
+// [ChartPkg.PinDigest] is set, OCI charts are pinned to a digest, which is
+// written to charts.k along with the tag.
+func (c *ChartPkg) add(config helmmodels.ChartConfig) error {
+	chart, repoURL, targetRevision := config.Chart, config.RepoURL, config.TargetRevision
+	schemaPath, genType, validateType := config.SchemaPath, config.SchemaGenerator, config.SchemaValidator
+
+	if c.PinDigest && helm.IsOCIRepoURL(repoURL) {
+		pinned, err := c.Client.PinOCIRevision(chart, repoURL, targetRevision, helm.Creds{})
+		if err != nil {
+			return fmt.Errorf("failed to pin chart digest: %w", err)
+		}
+		targetRevision = pinned
+	}
+
 	hc := helmmodels.Chart{
 		ChartBase: helmmodels.ChartBase{
 			Chart:           chart,
 			RepoURL:         repoURL,
 			TargetRevision:  targetRevision,
 			SchemaValidator: validateType,
+			Keyring:         config.Keyring,
 		},
 	}
 
 	chartDir := path.Join(c.BasePath, hc.GetSnakeCaseName())
 
+	helmChart := helm.NewChart(c.Client, helm.TemplateOpts{
+		ChartName:      chart,
+		TargetRevision: targetRevision,
+		RepoURL:        repoURL,
+		Keyring:        config.Keyring,
+	})
+	if err := c.checkCompatibility(helmChart); err != nil {
+		return err
+	}
+
 	if err := c.Init(); err != nil {
 		return fmt.Errorf("failed to init before add: %w", err)
 	}
@@ -75,11 +120,6 @@ func (c *ChartPkg) Add(
 				return filePathsEqual(f, schemaPath)
 			}
 		}
-		helmChart := helm.NewChart(c.Client, helm.TemplateOpts{
-			ChartName:      chart,
-			TargetRevision: targetRevision,
-			RepoURL:        repoURL,
-		})
 		jsonSchemaBytes, err = helmChart.GetValuesJSONSchema(jsonschema.GetGenerator(genType), fileMatcher)
 		if err != nil {
 			return fmt.Errorf("failed to generate schema: %w", err)
@@ -99,6 +139,7 @@ func (c *ChartPkg) Add(
 		"schemaGenerator": string(genType),
 		"schemaPath":      schemaPath,
 		"schemaValidator": string(validateType),
+		"keyring":         config.Keyring,
 	}
 	if err := c.updateChartsFile(c.BasePath, hc.GetSnakeCaseName(), chartConfig); err != nil {
 		return err
@@ -112,6 +153,23 @@ func (c *ChartPkg) Add(
 	return nil
 }
 
+// checkCompatibility checks the chart for compatibility issues. Issues are
+// logged as warnings, or returned as an error if
+// [ChartPkg.StrictCompatibility] is enabled.
+func (c *ChartPkg) checkCompatibility(helmChart *helm.Chart) error {
+	md, err := helmChart.GetChartMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to get chart metadata: %w", err)
+	}
+	if err := helm.CheckCompatibility(md, c.KubeVersion); err != nil {
+		if c.StrictCompatibility {
+			return fmt.Errorf("failed chart compatibility check: %w", err)
+		}
+		slog.Warn("chart compatibility check failed", "chart", md.Name, "err", err)
+	}
+	return nil
+}
+
 func (c *ChartPkg) generateAndWriteChartKCL(hc helmmodels.Chart, chartDir string) error {
 	kclChart := &bytes.Buffer{}
 	if err := hc.GenerateKCL(kclChart); err != nil {
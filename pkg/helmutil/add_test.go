@@ -62,7 +62,7 @@ func TestHelmChartAdd(t *testing.T) {
 			t.Parallel()
 
 			err := ca.Add(tc.chart.Chart, tc.chart.RepoURL, tc.chart.TargetRevision,
-				tc.chart.SchemaPath, tc.chart.SchemaGenerator, tc.chart.SchemaValidator)
+				tc.chart.SchemaPath, tc.chart.Keyring, tc.chart.SchemaGenerator, tc.chart.SchemaValidator)
 			require.NoError(t, err)
 
 			depsOpt, err := options.LoadDepsFrom(chartPath, true)
@@ -11,14 +11,51 @@ type ChartPkg struct {
 	BasePath string
 	Client   helm.ChartClient
 
+	// KubeVersion is the Kubernetes version that charts are checked against.
+	KubeVersion string
+	// StrictCompatibility causes chart compatibility issues (e.g. deprecated
+	// charts) to return errors, rather than only logging warnings.
+	StrictCompatibility bool
+	// PinDigest pins the targetRevision of OCI charts to the digest of the
+	// manifest it refers to (e.g. "1.2.3@sha256:..."). Revisions which are
+	// already pinned are not changed.
+	PinDigest bool
+
 	mu sync.RWMutex
 }
 
-func NewChartPkg(basePath string, client helm.ChartClient) *ChartPkg {
-	return &ChartPkg{
+type ChartPkgOpts func(c *ChartPkg)
+
+// WithKubeVersion sets the Kubernetes version that charts are checked against.
+func WithKubeVersion(kubeVersion string) ChartPkgOpts {
+	return func(c *ChartPkg) {
+		c.KubeVersion = kubeVersion
+	}
+}
+
+// WithStrictCompatibility causes chart compatibility issues to return errors.
+func WithStrictCompatibility(strict bool) ChartPkgOpts {
+	return func(c *ChartPkg) {
+		c.StrictCompatibility = strict
+	}
+}
+
+// WithPinDigest pins the targetRevision of OCI charts to a digest.
+func WithPinDigest(pin bool) ChartPkgOpts {
+	return func(c *ChartPkg) {
+		c.PinDigest = pin
+	}
+}
+
+func NewChartPkg(basePath string, client helm.ChartClient, opts ...ChartPkgOpts) *ChartPkg {
+	c := &ChartPkg{
 		BasePath: basePath,
 		Client:   client,
 	}
+	for i := range opts {
+		opts[i](c)
+	}
+	return c
 }
 
 func fileExists(path string) bool {
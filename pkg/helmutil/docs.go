@@ -0,0 +1,288 @@
+package helmutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/MacroPower/kclipper/pkg/helm"
+	"github.com/MacroPower/kclipper/pkg/helmmodels"
+)
+
+const docsIndexFile = "README.md"
+
+// valueDoc describes a single key in a chart's values.
+type valueDoc struct {
+	Key         string
+	Type        string
+	Default     string
+	Description string
+	Enum        string
+}
+
+// Docs loads the chart configurations defined in charts.k and writes a
+// Markdown reference page for each chart to outputDir, along with an index
+// page. Values are documented using the chart's generated values.schema.json,
+// and chart metadata is read from the chart's Chart.yaml. Output is
+// deterministic, so it can be committed alongside the charts package.
+func (c *ChartPkg) Docs(outputDir string) error {
+	chartData, err := c.loadChartData()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create docs directory: %w", err)
+	}
+
+	keys := make([]string, 0, len(chartData.Charts))
+	for k := range chartData.Charts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	metadata := map[string]*chart.Metadata{}
+	for _, k := range keys {
+		hc := chartData.Charts[k]
+		if k != hc.GetSnakeCaseName() {
+			return fmt.Errorf("chart key '%s' does not match chart name '%s'", k, hc.GetSnakeCaseName())
+		}
+
+		helmChart := helm.NewChart(c.Client, helm.TemplateOpts{
+			ChartName:       hc.Chart,
+			TargetRevision:  hc.TargetRevision,
+			RepoURL:         hc.RepoURL,
+			PassCredentials: hc.PassCredentials,
+			Keyring:         hc.Keyring,
+		})
+		md, err := helmChart.GetChartMetadata()
+		if err != nil {
+			return fmt.Errorf("failed to get metadata for chart '%s': %w", k, err)
+		}
+		metadata[k] = md
+
+		values, err := c.readValueDocs(k)
+		if err != nil {
+			return fmt.Errorf("failed to read values for chart '%s': %w", k, err)
+		}
+
+		page := renderChartDoc(hc, md, values)
+		if err := os.WriteFile(path.Join(outputDir, k+".md"), page, 0o600); err != nil {
+			return fmt.Errorf("failed to write docs for chart '%s': %w", k, err)
+		}
+	}
+
+	index := renderDocsIndex(keys, chartData.Charts, metadata)
+	if err := os.WriteFile(path.Join(outputDir, docsIndexFile), index, 0o600); err != nil {
+		return fmt.Errorf("failed to write docs index: %w", err)
+	}
+
+	return nil
+}
+
+// readValueDocs reads the values.schema.json for the given chart key. If the
+// chart has no schema (e.g. when using the NONE generator), no values are
+// returned.
+func (c *ChartPkg) readValueDocs(chartKey string) ([]valueDoc, error) {
+	schemaFile := path.Join(c.BasePath, chartKey, "values.schema.json")
+	if !fileExists(schemaFile) {
+		return nil, nil
+	}
+
+	schemaBytes, err := os.ReadFile(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %w", schemaFile, err)
+	}
+
+	schema := map[string]any{}
+	if err := json.Unmarshal(schemaBytes, &schema); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal '%s': %w", schemaFile, err)
+	}
+
+	values := []valueDoc{}
+	walkSchemaProperties("", schema, &values)
+
+	return values, nil
+}
+
+// walkSchemaProperties recursively collects a [valueDoc] for each property in
+// the given JSON Schema, in key order. Array items are documented with a `[]`
+// suffix on the parent key.
+func walkSchemaProperties(prefix string, schema map[string]any, values *[]valueDoc) {
+	props, ok := schema["properties"].(map[string]any)
+	if ok {
+		keys := make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			prop, ok := props[k].(map[string]any)
+			if !ok {
+				continue
+			}
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			*values = append(*values, newValueDoc(key, prop))
+			walkSchemaProperties(key, prop, values)
+		}
+	}
+
+	if items, ok := schema["items"].(map[string]any); ok && prefix != "" {
+		key := prefix + "[]"
+		*values = append(*values, newValueDoc(key, items))
+		walkSchemaProperties(key, items, values)
+	}
+}
+
+func newValueDoc(key string, prop map[string]any) valueDoc {
+	v := valueDoc{
+		Key:  key,
+		Type: schemaTypeString(prop["type"]),
+	}
+	if d, ok := prop["default"]; ok {
+		v.Default = compactJSON(d)
+	}
+	if d, ok := prop["description"].(string); ok {
+		v.Description = d
+	}
+	if e, ok := prop["enum"].([]any); ok {
+		enum := make([]string, 0, len(e))
+		for _, ev := range e {
+			enum = append(enum, compactJSON(ev))
+		}
+		v.Enum = strings.Join(enum, ", ")
+	}
+	return v
+}
+
+func schemaTypeString(t any) string {
+	switch tv := t.(type) {
+	case string:
+		return tv
+	case []any:
+		types := make([]string, 0, len(tv))
+		for _, v := range tv {
+			types = append(types, fmt.Sprint(v))
+		}
+		slices.Sort(types)
+		return strings.Join(types, " | ")
+	default:
+		return "any"
+	}
+}
+
+func compactJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// mdCell escapes a string for use in a Markdown table cell.
+func mdCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	s = strings.ReplaceAll(s, "\r\n", "<br />")
+	s = strings.ReplaceAll(s, "\n", "<br />")
+	return s
+}
+
+// mdCode wraps a non-empty string in a Markdown code span, for use in a
+// Markdown table cell.
+func mdCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "\r\n", " ")
+	s = strings.ReplaceAll(s, "\n", " ")
+	return "`" + s + "`"
+}
+
+func renderChartDoc(hc helmmodels.ChartConfig, md *chart.Metadata, values []valueDoc) []byte {
+	b := &bytes.Buffer{}
+
+	fmt.Fprintf(b, "# %s\n\n", hc.Chart)
+	if md.Description != "" {
+		fmt.Fprintf(b, "%s\n\n", strings.TrimSpace(md.Description))
+	}
+	if md.Deprecated {
+		b.WriteString("> :warning: This chart is deprecated.\n\n")
+	}
+
+	b.WriteString("## Chart\n\n")
+	b.WriteString("| Attribute | Value |\n")
+	b.WriteString("| :-------- | :---- |\n")
+	fmt.Fprintf(b, "| Name | %s |\n", mdCode(md.Name))
+	fmt.Fprintf(b, "| Version | %s |\n", mdCode(md.Version))
+	if md.AppVersion != "" {
+		fmt.Fprintf(b, "| App Version | %s |\n", mdCode(md.AppVersion))
+	}
+	fmt.Fprintf(b, "| Repository | %s |\n", mdCode(hc.RepoURL))
+	if md.Type != "" {
+		fmt.Fprintf(b, "| Type | %s |\n", mdCode(md.Type))
+	}
+	if md.KubeVersion != "" {
+		fmt.Fprintf(b, "| Kubernetes Version | %s |\n", mdCode(md.KubeVersion))
+	}
+	if md.Home != "" {
+		fmt.Fprintf(b, "| Home | %s |\n", mdCell(md.Home))
+	}
+	for _, s := range md.Sources {
+		fmt.Fprintf(b, "| Source | %s |\n", mdCell(s))
+	}
+	for _, m := range md.Maintainers {
+		if m == nil {
+			continue
+		}
+		fmt.Fprintf(b, "| Maintainer | %s |\n", mdCell(m.Name))
+	}
+	for _, d := range md.Dependencies {
+		if d == nil {
+			continue
+		}
+		fmt.Fprintf(b, "| Dependency | %s %s |\n", mdCode(d.Name), mdCode(d.Version))
+	}
+
+	b.WriteString("\n## Values\n\n")
+	if len(values) == 0 {
+		b.WriteString("No values schema is available for this chart.\n")
+		return b.Bytes()
+	}
+	b.WriteString("| Key | Type | Default | Description | Enum |\n")
+	b.WriteString("| :-- | :--- | :------ | :---------- | :--- |\n")
+	for _, v := range values {
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s |\n",
+			mdCode(v.Key), mdCell(v.Type), mdCode(v.Default), mdCell(v.Description), mdCode(v.Enum))
+	}
+
+	return b.Bytes()
+}
+
+func renderDocsIndex(keys []string, charts map[string]helmmodels.ChartConfig, metadata map[string]*chart.Metadata) []byte {
+	b := &bytes.Buffer{}
+
+	b.WriteString("# Charts\n\n")
+	b.WriteString("| Chart | Version | App Version | Description |\n")
+	b.WriteString("| :---- | :------ | :---------- | :---------- |\n")
+	for _, k := range keys {
+		md := metadata[k]
+		fmt.Fprintf(b, "| [%s](%s.md) | %s | %s | %s |\n",
+			charts[k].Chart, k, mdCode(md.Version), mdCode(md.AppVersion), mdCell(strings.TrimSpace(md.Description)))
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,57 @@
+package helmutil_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MacroPower/kclipper/pkg/helmtest"
+	"github.com/MacroPower/kclipper/pkg/helmutil"
+	"github.com/MacroPower/kclipper/pkg/jsonschema"
+)
+
+const (
+	docsBasePath = "testdata/docs"
+)
+
+func TestHelmChartDocs(t *testing.T) {
+	t.Parallel()
+
+	chartPath := path.Join(docsBasePath, "charts")
+	docsPath := path.Join(docsBasePath, "docs")
+	os.RemoveAll(path.Join(chartPath, "podinfo"))
+	os.RemoveAll(docsPath)
+
+	chartPkg := helmutil.NewChartPkg(chartPath, helmtest.DefaultTestClient)
+
+	err := chartPkg.Init()
+	require.NoError(t, err)
+
+	err = chartPkg.Add("podinfo", "https://stefanprodan.github.io/podinfo", "6.7.1", "", "",
+		jsonschema.DefaultGeneratorType, jsonschema.DefaultValidatorType)
+	require.NoError(t, err)
+
+	err = chartPkg.Docs(docsPath)
+	require.NoError(t, err)
+
+	index, err := os.ReadFile(path.Join(docsPath, "README.md"))
+	require.NoError(t, err)
+	require.Contains(t, string(index), "| [podinfo](podinfo.md) | `6.7.1` |")
+
+	page, err := os.ReadFile(path.Join(docsPath, "podinfo.md"))
+	require.NoError(t, err)
+	require.Contains(t, string(page), "# podinfo")
+	require.Contains(t, string(page), "| Version | `6.7.1` |")
+	require.Contains(t, string(page), "| `replicaCount` | integer | `1` |")
+	require.Contains(t, string(page), "| `certificate.dnsNames[]` | string |")
+
+	// Output must be stable across runs.
+	err = chartPkg.Docs(docsPath)
+	require.NoError(t, err)
+
+	rerun, err := os.ReadFile(path.Join(docsPath, "podinfo.md"))
+	require.NoError(t, err)
+	require.Equal(t, string(page), string(rerun))
+}
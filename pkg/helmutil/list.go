@@ -0,0 +1,80 @@
+package helmutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MacroPower/kclipper/pkg/helm"
+)
+
+// List loads the chart configurations defined in charts.k and writes a table
+// describing each chart to w. Any compatibility issues found for a chart (see
+// [helm.CheckCompatibility]) are included in the table. If
+// [ChartPkg.StrictCompatibility] is enabled, an error is returned after the
+// table is written if any issues were found.
+func (c *ChartPkg) List(w io.Writer) error {
+	chartData, err := c.loadChartData()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(chartData.Charts))
+	for k := range chartData.Charts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCHART\tVERSION\tAPP VERSION\tREPOSITORY\tWARNINGS")
+
+	var compatErrs []error
+	for _, k := range keys {
+		hc := chartData.Charts[k]
+		helmChart := helm.NewChart(c.Client, helm.TemplateOpts{
+			ChartName:       hc.Chart,
+			TargetRevision:  hc.TargetRevision,
+			RepoURL:         hc.RepoURL,
+			PassCredentials: hc.PassCredentials,
+			Keyring:         hc.Keyring,
+		})
+		md, err := helmChart.GetChartMetadata()
+		if err != nil {
+			return fmt.Errorf("failed to get metadata for chart '%s': %w", k, err)
+		}
+
+		warnings := []string{}
+		if err := helm.CheckCompatibility(md, c.KubeVersion); err != nil {
+			compatErrs = append(compatErrs, fmt.Errorf("chart '%s': %w", k, err))
+			for _, e := range unwrapJoined(err) {
+				warnings = append(warnings, e.Error())
+			}
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			k, hc.Chart, md.Version, md.AppVersion, hc.RepoURL, strings.Join(warnings, "; "))
+	}
+
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write chart list: %w", err)
+	}
+
+	if c.StrictCompatibility && len(compatErrs) > 0 {
+		return fmt.Errorf("failed chart compatibility check: %w", errors.Join(compatErrs...))
+	}
+
+	return nil
+}
+
+// unwrapJoined returns the errors joined by [errors.Join], or the error itself
+// if it was not created by [errors.Join].
+func unwrapJoined(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
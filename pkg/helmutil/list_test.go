@@ -0,0 +1,33 @@
+package helmutil_test
+
+import (
+	"bytes"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/MacroPower/kclipper/pkg/helmtest"
+	"github.com/MacroPower/kclipper/pkg/helmutil"
+)
+
+const (
+	listBasePath = "testdata/list"
+)
+
+func TestHelmChartList(t *testing.T) {
+	t.Parallel()
+
+	chartPath := path.Join(listBasePath, "charts")
+
+	chartPkg := helmutil.NewChartPkg(chartPath, helmtest.DefaultTestClient,
+		helmutil.WithKubeVersion("1.30.0"),
+		helmutil.WithStrictCompatibility(true),
+	)
+
+	out := &bytes.Buffer{}
+	err := chartPkg.List(out)
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "NAME")
+	require.Regexp(t, `podinfo\s+podinfo\s+6\.7\.1\s+6\.7\.1\s+https://stefanprodan\.github\.io/podinfo`, out.String())
+}
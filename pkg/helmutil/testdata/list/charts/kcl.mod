@@ -0,0 +1,7 @@
+[package]
+name = "charts"
+edition = "v0.11.0"
+version = "0.1.2"
+
+[dependencies]
+helm = { path = "../../../../../modules/helm" }
@@ -14,34 +14,42 @@ import (
 // Update loads the chart configurations defined in charts.k and calls Add to
 // generate all required chart packages.
 func (c *ChartPkg) Update() error {
+	chartData, err := c.loadChartData()
+	if err != nil {
+		return err
+	}
+
+	for k, chart := range chartData.Charts {
+		if k != chart.GetSnakeCaseName() {
+			return fmt.Errorf("chart key '%s' does not match chart name '%s'", k, chart.GetSnakeCaseName())
+		}
+		if err := c.add(chart); err != nil {
+			return fmt.Errorf("failed to update chart '%s': %w", k, err)
+		}
+	}
+
+	return nil
+}
+
+// loadChartData runs charts.k and returns the chart configurations it defines.
+func (c *ChartPkg) loadChartData() (*helmmodels.ChartData, error) {
 	depOpt, err := options.LoadDepsFrom(c.BasePath, true)
 	if err != nil {
-		return fmt.Errorf("failed to load KCL dependencies: %w", err)
+		return nil, fmt.Errorf("failed to load KCL dependencies: %w", err)
 	}
 
 	mainFile := path.Join(c.BasePath, "charts.k")
 	mainOutput, err := kcl.Run(mainFile, *depOpt)
 	if err != nil {
-		return fmt.Errorf("failed to run '%s': %w", mainFile, err)
+		return nil, fmt.Errorf("failed to run '%s': %w", mainFile, err)
 	}
 
 	mainData := mainOutput.GetRawJsonResult()
 
 	chartData := &helmmodels.ChartData{}
 	if err := json.Unmarshal([]byte(mainData), chartData); err != nil {
-		return fmt.Errorf("failed to unmarshal output from '%s': %w", mainFile, err)
+		return nil, fmt.Errorf("failed to unmarshal output from '%s': %w", mainFile, err)
 	}
 
-	for k, chart := range chartData.Charts {
-		if k != chart.GetSnakeCaseName() {
-			return fmt.Errorf("chart key '%s' does not match chart name '%s'", k, chart.GetSnakeCaseName())
-		}
-		err := c.Add(chart.Chart, chart.RepoURL, chart.TargetRevision,
-			chart.SchemaPath, chart.SchemaGenerator, chart.SchemaValidator)
-		if err != nil {
-			return fmt.Errorf("failed to update chart '%s': %w", k, err)
-		}
-	}
-
-	return nil
+	return chartData, nil
 }
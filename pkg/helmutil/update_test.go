@@ -27,7 +27,7 @@ func TestHelmChartUpdate(t *testing.T) {
 	err := chartPkg.Init()
 	require.NoError(t, err)
 
-	err = chartPkg.Add("podinfo", "https://stefanprodan.github.io/podinfo", "6.7.1", "",
+	err = chartPkg.Add("podinfo", "https://stefanprodan.github.io/podinfo", "6.7.1", "", "",
 		jsonschema.DefaultGeneratorType, jsonschema.DefaultValidatorType)
 	require.NoError(t, err)
 	os.RemoveAll(path.Join(chartPath, "podinfo"))
@@ -34,14 +34,16 @@ var GeneratorTypeEnum = []interface{}{
 type ValidatorType string
 
 const (
-	DefaultValidatorType ValidatorType = ""
-	KCLValidatorType     ValidatorType = "KCL"
-	HelmValidatorType    ValidatorType = "HELM"
+	DefaultValidatorType    ValidatorType = ""
+	KCLValidatorType        ValidatorType = "KCL"
+	HelmValidatorType       ValidatorType = "HELM"
+	JSONSchemaValidatorType ValidatorType = "JSONSCHEMA"
 )
 
 var ValidatorTypeEnum = []interface{}{
 	KCLValidatorType,
 	HelmValidatorType,
+	JSONSchemaValidatorType,
 }
 
 // GetGenerator returns a [FileGenerator] for the given [GeneratorType].
@@ -87,6 +89,8 @@ func GetValidatorType(t string) ValidatorType {
 		return KCLValidatorType
 	case string(HelmValidatorType):
 		return HelmValidatorType
+	case string(JSONSchemaValidatorType):
+		return JSONSchemaValidatorType
 	default:
 		return DefaultValidatorType
 	}
@@ -6,9 +6,12 @@ type SafeMethodArgs struct {
 	Args *plugin.MethodArgs
 }
 
+// exists returns true if the keyword argument was provided with a non-None
+// value. Optional schema attributes are passed as None when unset, so they are
+// treated the same as missing arguments.
 func (sma *SafeMethodArgs) exists(name string) bool {
-	_, ok := sma.Args.KwArgs[name]
-	return ok
+	v, ok := sma.Args.KwArgs[name]
+	return ok && v != nil
 }
 
 func (sma *SafeMethodArgs) StrKwArg(name, defaultValue string) string {
@@ -2,15 +2,30 @@ package os
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"strings"
 )
 
+// DisabledEnvVar disables running executables from KCL, including the os
+// plugin and Helm post-renderer executables, when set to "true".
+const DisabledEnvVar = "KCLX_OS_PLUGIN_DISABLED"
+
+var ErrExecDisabled = errors.New("running executables is disabled by " + DisabledEnvVar)
+
 type ExecOutput struct {
 	Stdout string
 	Stderr string
 }
 
+// ExecEnabled returns false if running executables is disabled by
+// [DisabledEnvVar].
+func ExecEnabled() bool {
+	return strings.ToLower(os.Getenv(DisabledEnvVar)) != "true"
+}
+
 func Exec(name string, arg []string, env []string) (*ExecOutput, error) {
 	cmd := exec.Command(name, arg...)
 	cmd.Env = env
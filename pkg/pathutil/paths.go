@@ -19,6 +19,13 @@ type TempPaths interface {
 	GetPaths() map[string]string
 }
 
+// Sealer is implemented by TempPaths which verify the contents of cached
+// files. Seal must be called after writing a file to a path returned by
+// GetPath, before the file is used.
+type Sealer interface {
+	Seal(path string) error
+}
+
 // RandomizedTempPaths allows generating and memoizing random paths, each path being mapped to a specific key.
 type RandomizedTempPaths struct {
 	root  string
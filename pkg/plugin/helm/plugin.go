@@ -1,78 +1,492 @@
 package helm
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"kcl-lang.io/kcl-go/pkg/plugin"
 
+	argohelm "github.com/MacroPower/kclipper/pkg/argoutil/helm"
+	"github.com/MacroPower/kclipper/pkg/capabilities"
 	"github.com/MacroPower/kclipper/pkg/helm"
 	kclutil "github.com/MacroPower/kclipper/pkg/kclutil"
+	kclos "github.com/MacroPower/kclipper/pkg/os"
 )
 
+// chartCache is shared by all charts rendered by the plugin, so that charts
+// rendered many times by the same program are only loaded once.
+var chartCache = argohelm.NewChartCache(argohelm.DefaultChartCacheSize)
+
 func Register() {
 	plugin.RegisterPlugin(Plugin)
 }
 
+// pullKwArgsType describes the keyword arguments accepted by each method that
+// pulls a chart.
+var pullKwArgsType = map[string]string{
+	"chart":            "str",
+	"target_revision":  "str",
+	"repo_url":         "str",
+	"path":             "str",
+	"pass_credentials": "bool",
+	"module_root":      "str",
+	"keyring":          "str",
+}
+
+// chartKwArgsType describes the keyword arguments accepted by each method
+// that renders a chart.
+var chartKwArgsType = map[string]string{
+	"chart":                      "str",
+	"target_revision":            "str",
+	"repo_url":                   "str",
+	"path":                       "str",
+	"release_name":               "str",
+	"namespace":                  "str",
+	"skip_crds":                  "bool",
+	"skip_schema_validation":     "bool",
+	"pass_credentials":           "bool",
+	"strict_compatibility":       "bool",
+	"kube_version":               "str",
+	"api_versions":               "[str]",
+	"capabilities":               "str",
+	"capabilities_file":          "str",
+	"repositories":               "[{str:str}]",
+	"include_hooks":              "bool",
+	"skip_tests":                 "bool",
+	"show_only":                  "[str]",
+	"patches":                    "[{str:any}]",
+	"lookup_objects":             "[{str:any}]",
+	"lookup_dir":                 "str",
+	"value_files":                "[str]",
+	"show_template_on_error":     "bool",
+	"ignore_missing_value_files": "bool",
+	"set":                        "[str]",
+	"set_string":                 "[str]",
+	"set_file":                   "[str]",
+	"inject_namespace":           "bool",
+	"flatten_lists":              "bool",
+	"drop_empty":                 "bool",
+	"sort_install_order":         "bool",
+	"crd_placement":              "str",
+	"validate_values_schema":     "bool",
+	"module_root":                "str",
+	"post_renderer_exec":         "{str:any}",
+	"keyring":                    "str",
+	"values":                     "{str:any}",
+}
+
 var Plugin = plugin.Plugin{
 	Name: "helm",
 	MethodMap: map[string]plugin.MethodSpec{
 		"template": {
 			Type: &plugin.MethodType{
-				KwArgsType: map[string]string{
-					"chart":                  "str",
-					"target_revision":        "str",
-					"repo_url":               "str",
-					"release_name":           "str",
-					"namespace":              "str",
-					"skip_crds":              "bool",
-					"skip_schema_validation": "bool",
-					"pass_credentials":       "bool",
-					"values":                 "{str:any}",
-				},
+				KwArgsType: chartKwArgsType,
 				ResultType: "[{str:any}]",
 			},
 			Body: func(args *plugin.MethodArgs) (*plugin.MethodResult, error) {
-				safeArgs := kclutil.SafeMethodArgs{Args: args}
+				helmChart, err := newChart(args)
+				if err != nil {
+					return nil, err
+				}
 
-				chartName := args.StrKwArg("chart")
-				targetRevision := args.StrKwArg("target_revision")
-				repoURL := args.StrKwArg("repo_url")
+				objs, err := helmChart.Template()
+				if err != nil {
+					return nil, templateError(helmChart, err)
+				}
 
-				// https://argo-cd.readthedocs.io/en/stable/user-guide/build-environment/
-				// https://github.com/argoproj/argo-cd/pull/15186
-				project := os.Getenv("ARGOCD_APP_PROJECT_NAME")
-				namespace := safeArgs.StrKwArg("namespace", os.Getenv("ARGOCD_APP_NAMESPACE"))
-				kubeVersion := os.Getenv("KUBE_VERSION")
-				kubeAPIVersions := os.Getenv("KUBE_API_VERSIONS")
+				return &plugin.MethodResult{V: objs}, nil
+			},
+		},
+		"release": {
+			Type: &plugin.MethodType{
+				KwArgsType: chartKwArgsType,
+				ResultType: "{str:any}",
+			},
+			Body: func(args *plugin.MethodArgs) (*plugin.MethodResult, error) {
+				helmChart, err := newChart(args)
+				if err != nil {
+					return nil, err
+				}
 
-				helmClient, err := helm.NewClient(helm.NewTempPaths(os.TempDir(), helm.NewBase64PathEncoder()), project, "10M")
+				rel, err := helmChart.Release()
 				if err != nil {
-					return nil, fmt.Errorf("failed to create helm client: %w", err)
+					return nil, templateError(helmChart, err)
 				}
 
-				helmChart := helm.NewChart(helmClient, helm.TemplateOpts{
-					ChartName:            chartName,
-					TargetRevision:       targetRevision,
-					RepoURL:              repoURL,
-					ReleaseName:          safeArgs.StrKwArg("release_name", chartName),
-					Namespace:            namespace,
-					SkipCRDs:             safeArgs.BoolKwArg("skip_crds", false),
-					SkipSchemaValidation: safeArgs.BoolKwArg("skip_schema_validation", true),
-					PassCredentials:      safeArgs.BoolKwArg("pass_credentials", false),
-					ValuesObject:         safeArgs.MapKwArg("values", map[string]any{}),
-					KubeVersion:          kubeVersion,
-					APIVersions:          strings.Split(kubeAPIVersions, ","),
-				})
+				return &plugin.MethodResult{V: rel}, nil
+			},
+		},
+		"show_values": {
+			Type: &plugin.MethodType{
+				KwArgsType: pullKwArgsType,
+				ResultType: "{str:any}",
+			},
+			Body: func(args *plugin.MethodArgs) (*plugin.MethodResult, error) {
+				helmChart, err := newPullChart(args)
+				if err != nil {
+					return nil, err
+				}
 
-				objs, err := helmChart.Template()
+				values, err := helmChart.ShowValues()
 				if err != nil {
-					return nil, fmt.Errorf("failed to template '%s': %w", chartName, err)
+					return nil, fmt.Errorf("failed to show values for '%s': %w", helmChart.TemplateOpts.ChartName, err)
 				}
 
-				return &plugin.MethodResult{V: objs}, nil
+				return &plugin.MethodResult{V: values}, nil
+			},
+		},
+		"show_chart": {
+			Type: &plugin.MethodType{
+				KwArgsType: pullKwArgsType,
+				ResultType: "{str:any}",
+			},
+			Body: func(args *plugin.MethodArgs) (*plugin.MethodResult, error) {
+				helmChart, err := newPullChart(args)
+				if err != nil {
+					return nil, err
+				}
+
+				md, err := helmChart.GetChartMetadata()
+				if err != nil {
+					return nil, fmt.Errorf("failed to show chart for '%s': %w", helmChart.TemplateOpts.ChartName, err)
+				}
+
+				return &plugin.MethodResult{V: md}, nil
+			},
+		},
+		"show_readme": {
+			Type: &plugin.MethodType{
+				KwArgsType: pullKwArgsType,
+				ResultType: "str",
+			},
+			Body: func(args *plugin.MethodArgs) (*plugin.MethodResult, error) {
+				helmChart, err := newPullChart(args)
+				if err != nil {
+					return nil, err
+				}
+
+				readme, err := helmChart.ShowReadme()
+				if err != nil {
+					return nil, fmt.Errorf("failed to show readme for '%s': %w", helmChart.TemplateOpts.ChartName, err)
+				}
+
+				return &plugin.MethodResult{V: readme}, nil
+			},
+		},
+		"read_file": {
+			Type: &plugin.MethodType{
+				ArgsType:   []string{"str"},
+				KwArgsType: pullKwArgsType,
+				ResultType: "str",
+			},
+			Body: func(args *plugin.MethodArgs) (*plugin.MethodResult, error) {
+				helmChart, err := newPullChart(args)
+				if err != nil {
+					return nil, err
+				}
+
+				path := args.StrArg(0)
+				data, err := helmChart.ReadFile(path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read '%s' from '%s': %w", path, helmChart.TemplateOpts.ChartName, err)
+				}
+
+				return &plugin.MethodResult{V: string(data)}, nil
 			},
 		},
 	},
 }
+
+// newPullChart returns a [helm.Chart] configured using the given method
+// arguments (see [pullKwArgsType]), which can be used to read the chart's
+// contents without rendering it.
+func newPullChart(args *plugin.MethodArgs) (*helm.Chart, error) {
+	safeArgs := kclutil.SafeMethodArgs{Args: args}
+
+	return helm.NewChart(helm.DefaultClient, helm.TemplateOpts{
+		ChartName:       args.StrKwArg("chart"),
+		TargetRevision:  args.StrKwArg("target_revision"),
+		RepoURL:         args.StrKwArg("repo_url"),
+		Path:            safeArgs.StrKwArg("path", ""),
+		PassCredentials: safeArgs.BoolKwArg("pass_credentials", false),
+		RepoRoot:        repoRoot(safeArgs.StrKwArg("module_root", "")),
+		Keyring:         safeArgs.StrKwArg("keyring", ""),
+	}), nil
+}
+
+// newChart returns a [helm.Chart] configured using the given method arguments
+// (see [chartKwArgsType]) and the environment.
+func newChart(args *plugin.MethodArgs) (*helm.Chart, error) {
+	safeArgs := kclutil.SafeMethodArgs{Args: args}
+
+	chartName := args.StrKwArg("chart")
+	targetRevision := args.StrKwArg("target_revision")
+	repoURL := args.StrKwArg("repo_url")
+
+	// https://argo-cd.readthedocs.io/en/stable/user-guide/build-environment/
+	// https://github.com/argoproj/argo-cd/pull/15186
+	namespace := safeArgs.StrKwArg("namespace", os.Getenv("ARGOCD_APP_NAMESPACE"))
+	kubeVersion := os.Getenv("KUBE_VERSION")
+	kubeAPIVersions := splitAPIVersions(os.Getenv("KUBE_API_VERSIONS"))
+	var clusterScopedKinds []string
+	if profileName := safeArgs.StrKwArg("capabilities", os.Getenv(capabilities.ProfileEnvVar)); profileName != "" {
+		profile, err := capabilities.LoadProfile(
+			safeArgs.StrKwArg("capabilities_file", os.Getenv(capabilities.FileEnvVar)), profileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load capabilities for '%s': %w", chartName, err)
+		}
+		if profile.KubeVersion != "" {
+			kubeVersion = profile.KubeVersion
+		}
+		if len(profile.APIVersions) > 0 {
+			kubeAPIVersions = profile.APIVersions
+		}
+		clusterScopedKinds = profile.ClusterScopedKinds
+	}
+	kubeVersion = safeArgs.StrKwArg("kube_version", kubeVersion)
+	if apiVersions := safeArgs.ListKwArg("api_versions", nil); apiVersions != nil {
+		kubeAPIVersions = toStrings(apiVersions)
+	}
+
+	patches, err := parsePatches(safeArgs.ListKwArg("patches", nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse patches for '%s': %w", chartName, err)
+	}
+
+	postRendererExec, err := parsePostRendererExec(safeArgs.MapKwArg("post_renderer_exec", nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse post-renderer for '%s': %w", chartName, err)
+	}
+
+	lookupObjects, err := parseLookupObjects(safeArgs.ListKwArg("lookup_objects", nil),
+		safeArgs.StrKwArg("lookup_dir", os.Getenv(helm.LookupDirEnvVar)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lookup objects for '%s': %w", chartName, err)
+	}
+
+	chartOpts := []helm.ChartOpts{helm.WithChartCache(chartCache)}
+	if cacheDir := os.Getenv(helm.RenderCacheDirEnvVar); cacheDir != "" {
+		renderCache, err := helm.NewRenderCache(cacheDir, os.Getenv(helm.RenderCacheMaxSizeEnvVar))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create render cache: %w", err)
+		}
+		chartOpts = append(chartOpts, helm.WithRenderCache(renderCache))
+	}
+
+	return helm.NewChart(helm.DefaultClient, helm.TemplateOpts{
+		ChartName:               chartName,
+		TargetRevision:          targetRevision,
+		RepoURL:                 repoURL,
+		ReleaseName:             safeArgs.StrKwArg("release_name", chartName),
+		Namespace:               namespace,
+		SkipCRDs:                safeArgs.BoolKwArg("skip_crds", false),
+		SkipSchemaValidation:    safeArgs.BoolKwArg("skip_schema_validation", true),
+		PassCredentials:         safeArgs.BoolKwArg("pass_credentials", false),
+		StrictCompatibility:     safeArgs.BoolKwArg("strict_compatibility", false),
+		ValuesObject:            safeArgs.MapKwArg("values", map[string]any{}),
+		KubeVersion:             kubeVersion,
+		APIVersions:             kubeAPIVersions,
+		Repositories:            parseRepositories(safeArgs.ListKwArg("repositories", nil)),
+		IncludeHooks:            safeArgs.BoolKwArg("include_hooks", false),
+		SkipTests:               safeArgs.BoolKwArg("skip_tests", false),
+		ShowOnly:                toStrings(safeArgs.ListKwArg("show_only", nil)),
+		Patches:                 patches,
+		LookupObjects:           lookupObjects,
+		ValueFiles:              toStrings(safeArgs.ListKwArg("value_files", nil)),
+		IgnoreMissingValueFiles: safeArgs.BoolKwArg("ignore_missing_value_files", false),
+		ShowTemplateOnError:     safeArgs.BoolKwArg("show_template_on_error", false),
+		Set:                     toStrings(safeArgs.ListKwArg("set", nil)),
+		SetString:               toStrings(safeArgs.ListKwArg("set_string", nil)),
+		SetFile:                 toStrings(safeArgs.ListKwArg("set_file", nil)),
+		InjectNamespace:         safeArgs.BoolKwArg("inject_namespace", false),
+		ClusterScopedKinds:      clusterScopedKinds,
+		FlattenLists:            safeArgs.BoolKwArg("flatten_lists", false),
+		DropEmpty:               safeArgs.BoolKwArg("drop_empty", false),
+		SortInstallOrder:        safeArgs.BoolKwArg("sort_install_order", false),
+		CRDPlacement:            helm.CRDPlacement(safeArgs.StrKwArg("crd_placement", "")),
+		ValidateValuesSchema:    safeArgs.BoolKwArg("validate_values_schema", false),
+		RepoRoot:                repoRoot(safeArgs.StrKwArg("module_root", "")),
+		Path:                    safeArgs.StrKwArg("path", ""),
+		PostRendererExec:        postRendererExec,
+		Keyring:                 safeArgs.StrKwArg("keyring", ""),
+	}, chartOpts...), nil
+}
+
+// repoRoot returns the directory that relative local chart repositories are
+// resolved from, given the root of the calling KCL module. If moduleRoot is a
+// file (e.g. when running a single KCL file), its directory is used.
+func repoRoot(moduleRoot string) string {
+	if moduleRoot == "" {
+		return ""
+	}
+	if fi, err := os.Stat(moduleRoot); err == nil && !fi.IsDir() {
+		return filepath.Dir(moduleRoot)
+	}
+	return moduleRoot
+}
+
+// templateError returns the error for a failure to render the given chart.
+// Template errors are returned without any intermediate wrapping, so that KCL
+// reports the template's location and message directly.
+func templateError(c *helm.Chart, err error) error {
+	if tplErr, ok := argohelm.AsTemplateError(err); ok {
+		err = tplErr
+	}
+	return fmt.Errorf("failed to template '%s': %w", c.TemplateOpts.ChartName, err)
+}
+
+// splitAPIVersions splits a comma-separated list of API versions, ignoring any
+// empty entries (e.g. when the list itself is empty).
+func splitAPIVersions(s string) []string {
+	apiVersions := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			apiVersions = append(apiVersions, v)
+		}
+	}
+	return apiVersions
+}
+
+// toStrings converts a list of values to a list of strings.
+func toStrings(l []any) []string {
+	s := make([]string, 0, len(l))
+	for _, v := range l {
+		s = append(s, fmt.Sprint(v))
+	}
+	return s
+}
+
+// parseRepositories converts a list of repository configs, each with a `name`,
+// `url`, and optionally a `username` and `password`, into Helm repositories
+// used for resolving chart dependencies.
+func parseRepositories(repos []any) []argohelm.HelmRepository {
+	helmRepos := make([]argohelm.HelmRepository, 0, len(repos))
+	for _, r := range repos {
+		repo, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		repoURL := mapStr(repo, "url")
+		helmRepos = append(helmRepos, argohelm.HelmRepository{
+			Name:      mapStr(repo, "name"),
+			Repo:      repoURL,
+			EnableOci: argohelm.IsHelmOciRepo(repoURL) || strings.HasPrefix(repoURL, "oci://"),
+			Creds: argohelm.Creds{
+				Username: mapStr(repo, "username"),
+				Password: mapStr(repo, "password"),
+			},
+		})
+	}
+	return helmRepos
+}
+
+// parseLookupObjects returns the objects served to Helm's `lookup` function,
+// from both the given list and any files in the given directory. If neither is
+// set, nil is returned, and `lookup` always returns an empty result.
+func parseLookupObjects(objs []any, dir string) ([]map[string]any, error) {
+	if objs == nil && dir == "" {
+		return nil, nil
+	}
+	lookupObjects := make([]map[string]any, 0, len(objs))
+	for i, o := range objs {
+		obj, ok := o.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("lookup object %d: expected a dict, got %T", i, o)
+		}
+		lookupObjects = append(lookupObjects, obj)
+	}
+	if dir != "" {
+		dirObjs, err := helm.LoadLookupObjects(dir)
+		if err != nil {
+			return nil, err
+		}
+		lookupObjects = append(lookupObjects, dirObjs...)
+	}
+	return lookupObjects, nil
+}
+
+// parsePatches converts a list of patch configs, each with a `patch` and
+// optionally a `target`, into patches applied to the rendered objects. The
+// `patch` may be a string, or a dict or list which is converted to JSON.
+func parsePatches(patches []any) ([]helm.Patch, error) {
+	helmPatches := make([]helm.Patch, 0, len(patches))
+	for i, p := range patches {
+		patch, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("patch %d: expected a dict, got %T", i, p)
+		}
+
+		var patchStr string
+		switch v := patch["patch"].(type) {
+		case string:
+			patchStr = v
+		case nil:
+			return nil, fmt.Errorf("patch %d: patch is required", i)
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("patch %d: failed to marshal patch: %w", i, err)
+			}
+			patchStr = string(b)
+		}
+
+		helmPatch := helm.Patch{Patch: patchStr}
+		if target, ok := patch["target"].(map[string]any); ok {
+			helmPatch.Target = &helm.PatchTarget{
+				Group:              mapStr(target, "group"),
+				Version:            mapStr(target, "version"),
+				Kind:               mapStr(target, "kind"),
+				Name:               mapStr(target, "name"),
+				Namespace:          mapStr(target, "namespace"),
+				LabelSelector:      mapStr(target, "labelSelector"),
+				AnnotationSelector: mapStr(target, "annotationSelector"),
+			}
+		}
+		helmPatches = append(helmPatches, helmPatch)
+	}
+	return helmPatches, nil
+}
+
+// mapStr returns the value of key k in m as a string, or an empty string if
+// it is missing or nil.
+func mapStr(m map[string]any, k string) string {
+	if v, ok := m[k]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// parsePostRendererExec converts a post-renderer config, with a `command` and
+// optionally `args` and a `timeout` (e.g. "30s"), into a post-renderer
+// executable. Post-renderers run executables in the same way as the os
+// plugin, so they are disabled along with it (see [kclos.DisabledEnvVar]).
+func parsePostRendererExec(config map[string]any) (*helm.PostRendererExec, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if !kclos.ExecEnabled() {
+		return nil, kclos.ErrExecDisabled
+	}
+
+	command, _ := config["command"].(string)
+	if command == "" {
+		return nil, errors.New("command is required")
+	}
+	p := &helm.PostRendererExec{Command: command}
+	if args, ok := config["args"].([]any); ok {
+		p.Args = toStrings(args)
+	}
+	if timeout, ok := config["timeout"].(string); ok && timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		p.Timeout = d
+	}
+	return p, nil
+}